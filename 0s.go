@@ -4,50 +4,201 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/kevinburke/ssh_config"
 	"github.com/melbahja/goph"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
 )
 
 var configFilePath string
 
-func init() {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		fmt.Printf("Error getting user home directory: %v\n", err)
-		os.Exit(1)
-	}
+var (
+	configFlag    = flag.String("config", "", "path to the configuration file")
+	hostFlag      = flag.String("host", "", "host of the repository")
+	portFlag      = flag.Uint("port", 0, "port of the repository")
+	userFlag      = flag.String("user", "", "user name for the repository")
+	keyFlag       = flag.String("key", "", "private key file for the repository")
+	passwordFlag  = flag.String("password", "", "password for the repository")
+	pathFlag      = flag.String("path", "", "path of the repository")
+	forceFlag     = flag.Bool("force", false, "overwrite existing entries and do not ask for confirmation")
+	quietFlag     = flag.Bool("quiet", false, "do not report transfer progress nor informational messages")
+	verboseFlag   = flag.Bool("verbose", false, "report connections, walked directories and each transfer")
+	dryRunFlag    = flag.Bool("dry-run", false, "show what would be done without doing it")
+	verifyFlag    = flag.Bool("verify", false, "verify checksums after transfers")
+	parallelFlag  = flag.Int("parallel", 4, "number of files transferred in parallel")
+	deleteFlag    = flag.Bool("delete", false, "delete local files missing from the repository")
+	resumeFlag    = flag.Bool("resume", false, "resume partially downloaded files")
+	recursiveFlag = flag.Bool("recursive", false, "remove directories and their contents, or list them with show")
+	sshHostFlag   = flag.String("ssh-host", "", "host of ~/.ssh/config to connect to")
+	typeFlag      = flag.String("type", "", "only find files (f) or directories (d)")
+	maxDepthFlag  = flag.Int("maxdepth", -1, "descend at most this many levels with find")
+	summarizeFlag = flag.Bool("summarize", false, "only print the total size with du")
+	depthFlag     = flag.Int("depth", -1, "descend at most this many levels with tree")
+	dirsOnlyFlag  = flag.Bool("dirs-only", false, "only show directories with tree")
+	noPermsFlag   = flag.Bool("no-perms", false, "do not preserve permissions and modification times")
+	jsonFlag      = flag.Bool("json", false, "print machine-readable JSON")
+	shareFlag     = flag.String("share", "", "smb:// URL of a network share")
+	rootFlag      = flag.String("root", "", "highest directory cd may reach in the repository")
+	domainFlag    = flag.String("domain", "", "Windows domain of the user of a network share")
+	limitFlag     = flag.String("limit", "", "maximum transfer rate in bytes per second, e.g. 2M")
+	retriesFlag   = flag.Int("retries", 3, "number of retries of failed connections and transfers")
+	outFlag       = flag.String("out", "", "directory 'get' downloads to, instead of the repository download_dir")
+	gzipFlag      = flag.Bool("gzip", false, "compress SSH transfers of files with gzip")
+	linesFlag     = flag.Int("n", 10, "number of lines printed by head and tail")
+	followLogFlag = flag.Bool("f", false, "keep printing the data appended to the file with tail")
+	ignoreFlag    = flag.String("exclude-from", "", "file of patterns to exclude, as in .gitignore")
+	outputFlag    = flag.String("output", "text", "report transfers as text or as json lines")
+	followFlag    = flag.Bool("follow-symlinks", false, "copy what symbolic links point to instead of the links")
+	sinceFlag     = flag.String("since", "", "only transfer or find the files modified since a duration ago or a date")
+	minSizeFlag   = flag.String("min-size", "", "only transfer or find the files of at least this size, e.g. 10K")
+	maxSizeFlag   = flag.String("max-size", "", "only transfer or find the files of at most this size, e.g. 100M")
+	updateFlag    = flag.Bool("update", false, "skip the local copies of files of the same size and modification time")
+	checksumFlag  = flag.Bool("checksum", false, "skip the local copies of files of the same contents")
+	clearFlag     = flag.Bool("clear", false, "empty the history")
+	allFlag       = flag.Bool("all", false, "ping every repository")
+	noSecretsFlag = flag.Bool("no-secrets", false, "leave the passwords and keys out of the exported configuration")
+	secretsFlag   = flag.Bool("show-secrets", false, "print passwords and keys with config get")
+	overwriteFlag = flag.Bool("overwrite", false, "replace the repositories of the same name on import")
+	stdinFlag     = flag.Bool("stdin", false, "put what is piped on stdin under the given name")
+	stdoutFlag    = flag.Bool("stdout", false, "write the file given to get to stdout")
+	sessionsFlag  = flag.Int("sessions", 2, "SFTP sessions opened over one SSH connection for parallel downloads")
+	noCaseFlag    = flag.Bool("ignore-case", false, "match without regard to case with grep")
+	parentsFlag   = flag.Bool("create-dirs", true, "create the missing parent directories of the destination of put")
+	repoFlag      = flag.String("repo", "", "repository to work on instead of the current one, for this command only")
+	sortFlag      = flag.String("sort", "name", "order of the show listing: name, size or time")
+	reverseFlag   = flag.Bool("reverse", false, "reverse the order of the show listing")
+	deadlineFlag  = flag.Duration("deadline", 0, "abort the command if still running after this duration, e.g. 5m")
+)
 
-	appDir := filepath.Join(homeDir, ".0s")
-	err = os.MkdirAll(appDir, 0755)
-	if err != nil {
-		fmt.Printf("Error creating application directory '%s': %v\n", appDir, err)
-		os.Exit(1)
-	}
+func init() {
+	// Short aliases
+	flag.BoolVar(recursiveFlag, "r", false, "alias for --recursive")
+	flag.BoolVar(recursiveFlag, "R", false, "alias for --recursive")
+	flag.BoolVar(quietFlag, "q", false, "alias for --quiet")
+	flag.BoolVar(verboseFlag, "v", false, "alias for --verbose")
+	flag.StringVar(sinceFlag, "newer-than", "", "alias for --since")
+	flag.BoolVar(noCaseFlag, "i", false, "alias for --ignore-case")
+	flag.BoolVar(followFlag, "follow", false, "alias for --follow-symlinks")
 
-	configFilePath = filepath.Join(appDir, "config.json")
+	// Repeatable flags
+	flag.Var(&includeFlag, "include", "only transfer the files matching this pattern")
+	flag.Var(&excludeFlag, "exclude", "do not transfer the entries matching this pattern")
 }
 
 type Config struct {
 	Current      string                `json:"current"`
 	Repositories map[string]Repository `json:"repositories"`
+
+	// picked is the repository --repo made current for the running
+	// command, saved keeping the current one of the configuration
+	picked string
+	saved  string
 }
 
 type Repository struct {
+	Name       string `json:"-"`
 	Type       string `json:"type"`
 	Path       string `json:"path,omitempty"`
 	Host       string `json:"host,omitempty"`
 	Port       uint   `json:"port,omitempty"`
 	User       string `json:"user,omitempty"`
-	PrivateKey string `json:"private_key,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"` // comma separated key files, tried in order
+	Passphrase string `json:"passphrase,omitempty"`
 	Password   string `json:"password,omitempty"`
+	UseAgent   bool   `json:"use_agent,omitempty"`
+	Bucket     string `json:"bucket,omitempty"`
+	Region     string `json:"region,omitempty"`
+	AccessKey  string `json:"access_key,omitempty"`
+	SecretKey  string `json:"secret_key,omitempty"`
+	Endpoint   string `json:"endpoint,omitempty"`
+
+	// CredentialsFile is the service account key of a GCS repository
+	CredentialsFile string `json:"credentials_file,omitempty"`
+
+	// Storage account and container of an Azure Blob repository, without
+	// key only public containers can be read
+	AccountName string `json:"account_name,omitempty"`
+	AccountKey  string `json:"account_key,omitempty"`
+	Container   string `json:"container,omitempty"`
+
+	// KeyboardInteractive also offers keyboard-interactive authentication,
+	// prompting on the terminal for each challenge of the server, such as
+	// a one-time password asked for in addition to a key
+	KeyboardInteractive bool `json:"keyboard_interactive,omitempty"`
+
+	// InsecureSkipVerify disables host key checking against known_hosts
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+
+	// HostKeyFingerprint pins the SHA256 fingerprint of the host key, as
+	// printed by ssh-keygen -l, instead of checking known_hosts
+	HostKeyFingerprint string `json:"host_key_fingerprint,omitempty"`
+
+	// Proxy is the socks5://, socks5h:// or http:// URL of the proxy SSH
+	// connections go through, with optional user:password@ credentials
+	Proxy string `json:"proxy,omitempty"`
+
+	// Jump is the bastion SSH connections go through, with its own host,
+	// port, user and credentials
+	Jump *Repository `json:"jump,omitempty"`
+
+	// Compress streams the files of SSH transfers through gzip on the
+	// server, as --gzip does
+	Compress bool `json:"compress,omitempty"`
+
+	// Timeout is the connection timeout in seconds (default 10)
+	Timeout uint `json:"timeout,omitempty"`
+
+	// SSHHost is a Host of ~/.ssh/config filling the connection settings
+	// not given explicitly
+	SSHHost string `json:"ssh_host,omitempty"`
+
+	// DownloadDir is where 'get' puts files instead of the working
+	// directory, ~ standing for the home directory
+	DownloadDir string `json:"download_dir,omitempty"`
+
+	// ShareURL is the smb:// URL of a network share, used when Path is not
+	// mounted
+	ShareURL string `json:"share_url,omitempty"`
+
+	// Domain is the Windows domain of User on network shares, which may
+	// also be given as DOMAIN\user
+	Domain string `json:"domain,omitempty"`
+
+	// Root is the highest directory 'cd' may reach, and the one absolute
+	// directories given to 'cd' start from (default: the filesystem root)
+	Root string `json:"root,omitempty"`
+
+	// PreviousPath is the directory before the last 'cd', where 'cd -'
+	// returns
+	PreviousPath string `json:"previous_path,omitempty"`
+
+	// unexpanded keeps the path settings as written in the configuration
+	unexpanded *configPaths
 }
 
 var (
@@ -57,56 +208,427 @@ var (
 )
 
 func main() {
+	// Get command-line flags and arguments
+	flag.Usage = printUsage
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	args, err := parseArgs(os.Args[1:])
+	if err == flag.ErrHelp {
+		os.Exit(exitOK)
+	} else if err != nil {
+		os.Exit(exitUsage)
+	}
+
+	// Run command, the exit code depends on the error
+	err = run(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// run loads the configuration and runs the command given in args.
+func run(args []string) error {
+	// Set the level of the messages printed
+	err := setVerbosity()
+	if err != nil {
+		return usageError(err)
+	}
+
+	err = checkOutput()
+	if err != nil {
+		return usageError(err)
+	}
+
+	// Read the patterns to leave out of transfers
+	err = loadExcludeFrom()
+	if err != nil {
+		return usageError(err)
+	}
+	err = setFileFilters()
+	if err != nil {
+		return usageError(err)
+	}
+
+	// Throttle transfers if asked to
+	if *limitFlag != "" {
+		err := setLimit(*limitFlag)
+		if err != nil {
+			return usageError(err)
+		}
+	}
+
+	// Locate configuration file
+	configPath, err := resolveConfigPath()
+	if err != nil {
+		return configError(fmt.Errorf("cannot locate configuration: %w", err))
+	}
+	configFilePath = configPath
+
+	// Commands changing the configuration keep it to themselves until saved
+	if len(args) > 0 && changesConfig(args[0]) {
+		unlock, err := lockConfig(true)
+		if err != nil {
+			return configError(err)
+		}
+		defer unlock()
+		configLocked = true
+	}
+
 	// Load configuration
 	config, err := loadConfig()
 	if err != nil {
-		fmt.Println("Error loading configuration:", err)
-		os.Exit(1)
+		return configError(fmt.Errorf("cannot load configuration: %w", err))
 	}
 
-	// Get command-line arguments
-	args := os.Args[1:]
-
 	// Check for commands
 	if len(args) == 0 {
 		printUsage()
-		os.Exit(1)
+		return usageError(errors.New("no command given"))
+	}
+
+	// Work on another repository than the current one if asked to
+	if *repoFlag != "" {
+		restore, err := pickRepository(config, *repoFlag)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+
+	// Report all the configuration problems at once, but for 'check' that
+	// reports them itself. Those of the current repository are fatal, unless
+	// the command manages the configuration and may be used to fix them.
+	var problems []error
+	if args[0] != "check" {
+		problems = validateConfig(config)
+	}
+	fatal := false
+	for _, problem := range problems {
+		if isFatal(problem, config) && usesRepository(args[0]) {
+			fmt.Fprintln(os.Stderr, "Error:", problem)
+			fatal = true
+		} else {
+			fmt.Fprintln(os.Stderr, "Warning:", problem)
+		}
+	}
+	if fatal {
+		return configError(fmt.Errorf("invalid configuration in '%s'", configFilePath))
+	}
+
+	return runCommand(config, args)
+}
+
+// runCommand runs the command given in args against config.
+func runCommand(config *Config, args []string) error {
+	// Stop at the deadline or on Ctrl-C, each command of an interactive
+	// session on its own
+	if args[0] != "interactive" {
+		done, err := startOperation()
+		if err != nil {
+			return usageError(err)
+		}
+		defer done()
 	}
 
 	switch args[0] {
-	case "list":
-		listRepositories(config)
+	case "list", "repos":
+		return listRepositories(config)
 	case "set":
 		if len(args) < 2 {
-			fmt.Println("Please specify a repository to set.")
-			os.Exit(1)
+			return usageError(errors.New("please specify a repository to set"))
+		}
+		return setRepository(config, args[1])
+	case "add":
+		if len(args) < 3 {
+			return usageError(errors.New("please specify a name and a type for the repository to add"))
+		}
+		return addRepository(config, args[1:])
+	case "remove", "del-repo":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a repository to remove"))
+		}
+		return deleteRepository(config, args[1])
+	case "rename-repo":
+		if len(args) < 3 {
+			return usageError(errors.New("please specify the repository to rename and its new name"))
+		}
+		return renameRepository(config, args[1], args[2])
+	case "copy-repo":
+		if len(args) < 3 {
+			return usageError(errors.New("please specify the repository to copy and the name of the copy"))
+		}
+		return copyRepository(config, args[1], args[2])
+	case "export":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify the file to export to, or - for stdout"))
+		}
+		return exportConfig(config, args[1])
+	case "import":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify the configuration file to import"))
 		}
-		setRepository(config, args[1])
+		return importConfig(config, args[1])
+	case "config":
+		return configCommand(config, args[1:])
 	case "show":
-		showRepository(config)
+		return showRepository(config)
+	case "pwd":
+		printWorkingDirectory(config)
+	case "whoami":
+		return whoamiRepository(config)
 	case "get":
 		if len(args) < 2 {
-			fmt.Println("Please specify a file or folder to get.")
-			os.Exit(1)
+			return usageError(errors.New("please specify a file or folder to get"))
 		}
-		getRepository(config, args[1])
+		return withHistory(config, "get", args[1], func() error {
+			return getRepository(config, args[1])
+		})
 	case "put":
 		if len(args) < 2 {
-			fmt.Println("Please specify a file or folder to put.")
-			os.Exit(1)
+			return usageError(errors.New("please specify a file or folder to put"))
+		}
+		return withHistory(config, "put", args[1], func() error {
+			return putRepository(config, args[1])
+		})
+	case "transfer":
+		if len(args) < 3 {
+			return usageError(errors.New("please specify a source and a destination, as <repo>:<path>"))
+		}
+		return transferRepositories(config, args[1], args[2])
+	case "broadcast":
+		if len(args) < 3 {
+			return usageError(errors.New("please specify a file or folder and the repositories to put it in"))
+		}
+		return broadcastRepositories(config, args[1], args[2])
+	case "rm":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a file or folder to remove"))
+		}
+		return withHistory(config, "rm", args[1], func() error {
+			return removeRepository(config, args[1])
+		})
+	case "mv":
+		if len(args) < 3 {
+			return usageError(errors.New("please specify a source and a destination to move"))
+		}
+		return moveRepository(config, args[1], args[2])
+	case "touch":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a file to touch"))
+		}
+		return touchRepository(config, args[1])
+	case "cat":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a file to print"))
+		}
+		return catRepository(config, args[1])
+	case "head", "tail":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a file to print"))
+		}
+		if *linesFlag < 0 {
+			return usageError(fmt.Errorf("invalid line count %d", *linesFlag))
+		}
+		if args[0] == "head" {
+			return headRepository(config, args[1])
+		}
+		return tailRepository(config, args[1])
+	case "diff":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a file to compare"))
 		}
-		putRepository(config, args[1])
+		return diffRepository(config, args[1])
+	case "edit":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a file to edit"))
+		}
+		return editRepository(config, args[1])
+	case "open":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a file to open"))
+		}
+		return openRepository(config, args[1])
+	case "find":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a pattern to find"))
+		}
+		return findRepository(config, args[1])
+	case "grep":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a pattern to search for"))
+		}
+		name := ""
+		if len(args) > 2 {
+			name = args[2]
+		}
+		return grepRepository(config, args[1], name)
+	case "du":
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		return diskUsage(config, name)
+	case "tree":
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
+		}
+		return printTree(config, name)
+	case "stat", "info":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a file or folder to inspect"))
+		}
+		return statRepository(config, args[1])
+	case "sync":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a local directory to sync"))
+		}
+		return syncRepository(config, args[1])
+	case "pull":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a local directory to pull into"))
+		}
+		return pullRepository(config, args[1])
+	case "mirror":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a local directory to mirror"))
+		}
+		return mirrorRepository(config, args[1])
+	case "clone":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a local directory to clone into"))
+		}
+		return cloneRepository(config, args[1])
 	case "cd":
 		if len(args) < 2 {
-			fmt.Println("Please specify a directory to change to.")
-			os.Exit(1)
+			return usageError(errors.New("please specify a directory to change to"))
+		}
+		return changeDirectory(config, args[1])
+	case "check":
+		return checkConfig(config)
+	case "ping":
+		name := ""
+		if len(args) > 1 {
+			name = args[1]
 		}
-		changeDirectory(config, args[1])
+		return pingRepositories(config, name)
+	case "history":
+		count := ""
+		if len(args) > 1 {
+			count = args[1]
+		}
+		return showHistory(count)
+	case "interactive":
+		return interactive(config)
 	case "version":
 		printVersion()
+	case "completion":
+		if len(args) < 2 {
+			return usageError(errors.New("please specify a shell (bash or zsh)"))
+		}
+		return printCompletion(args[1])
+	case "__complete":
+		// Hidden, used by the completion scripts
+		if len(args) < 2 {
+			return usageError(errors.New("please specify what to complete"))
+		}
+		return completeRepository(config, args[1])
 	default:
-		printUsage()
+		// The usage would flood an interactive session
+		if sharedSSHClients == nil {
+			printUsage()
+		}
+		return usageError(fmt.Errorf("unknown command '%s'", args[0]))
+	}
+
+	return nil
+}
+
+// parseArgs parses the flags found anywhere on the command line and returns
+// the remaining positional arguments. Everything after "--" is positional.
+func parseArgs(arguments []string) ([]string, error) {
+	var positional []string
+	for len(arguments) > 0 {
+		err := flag.CommandLine.Parse(arguments)
+		if err != nil {
+			return nil, err
+		}
+		remaining := flag.Args()
+
+		consumed := arguments[:len(arguments)-len(remaining)]
+		if len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			positional = append(positional, remaining...)
+			break
+		}
+
+		if len(remaining) > 0 {
+			positional = append(positional, remaining[0])
+			remaining = remaining[1:]
+		}
+		arguments = remaining
+	}
+	return positional, nil
+}
+
+// resolveConfigPath returns the configuration file to use, looking in order
+// at the --config flag, the ZEROS_CONFIG environment variable, a project
+// .0s/config.json in the working directory or above, the XDG config
+// directory and the legacy ~/.0s directory. New configurations are created
+// in the XDG config directory.
+func resolveConfigPath() (string, error) {
+	if *configFlag != "" {
+		return *configFlag, nil
+	}
+	if envPath := os.Getenv("ZEROS_CONFIG"); envPath != "" {
+		return envPath, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user home directory: %w", err)
+	}
+
+	if projectPath := findProjectConfig(homeDir); projectPath != "" {
+		return projectPath, nil
+	}
+
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		configDir = filepath.Join(homeDir, ".config")
+	}
+	xdgPath := filepath.Join(configDir, "0s", "config.json")
+	if _, err := os.Stat(xdgPath); err == nil {
+		return xdgPath, nil
+	}
+
+	legacyPath := filepath.Join(homeDir, ".0s", "config.json")
+	if _, err := os.Stat(legacyPath); err == nil {
+		return legacyPath, nil
+	}
+
+	return xdgPath, nil
+}
+
+// findProjectConfig looks for a .0s/config.json in the working directory
+// and its parents, as git does for .git, and returns the first one found.
+// The search stops below homeDir, whose .0s is the legacy global location.
+func findProjectConfig(homeDir string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for dir != homeDir {
+		projectPath := filepath.Join(dir, ".0s", "config.json")
+		if _, err := os.Stat(projectPath); err == nil {
+			return projectPath
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
 	}
+	return ""
 }
 
 func printVersion() {
@@ -136,13 +658,13 @@ func createDefaultConfig() *Config {
 func loadConfig() (*Config, error) {
 	// Check if config file exists
 	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
-		fmt.Printf("Configuration file not found at '%s'. Creating a default config.\n", configFilePath)
+		infof("Configuration file not found at '%s'. Creating a default config.\n", configFilePath)
 		defaultConfig := createDefaultConfig()
 		err := saveConfig(defaultConfig)
 		if err != nil {
 			return nil, fmt.Errorf("error saving default configuration: %w", err)
 		}
-		fmt.Println("Default configuration created with sample repositories. Please edit it to set up your repositories.\n")
+		infof("Default configuration created with sample repositories. Please edit it to set up your repositories.\n\n")
 		// Ensure the directory for /tmp/0s_local is created if it's the default path for localrepo
 		localRepoPath := defaultConfig.Repositories["localrepo"].Path
 		if localRepoPath != "" {
@@ -150,6 +672,15 @@ func loadConfig() (*Config, error) {
 		}
 	}
 
+	// Do not read a configuration being written
+	if !configLocked {
+		unlock, err := lockConfig(false)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
 	// Open config file
 	configFile, err := os.Open(configFilePath)
 	if err != nil {
@@ -162,22 +693,59 @@ func loadConfig() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseConfig(byteValue)
+}
 
+// parseConfig reads a configuration as written in a file, expanding its
+// paths and decrypting its passwords.
+func parseConfig(byteValue []byte) (*Config, error) {
 	// Unmarshal JSON
 	var config Config
-	json.Unmarshal(byteValue, &config)
+	err := json.Unmarshal(byteValue, &config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config JSON: %w", err)
+	}
+	if config.Repositories == nil {
+		config.Repositories = map[string]Repository{}
+	}
+
+	// Let each repository know its own name, and expand its paths
+	homeDir, _ := os.UserHomeDir()
+	for name, repo := range config.Repositories {
+		repo.Name = name
+		expandRepositoryPaths(&repo, homeDir)
+		config.Repositories[name] = repo
+	}
+
+	// Decrypt the passwords stored encrypted
+	err = decryptRepositories(&config)
+	if err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
 
 func saveConfig(config *Config) error {
-	// Marshal JSON
-	byteValue, err := json.MarshalIndent(config, "", "  ")
+	byteValue, err := marshalConfig(config)
+	if err != nil {
+		return err
+	}
+
+	// Create config directory
+	err = os.MkdirAll(filepath.Dir(configFilePath), 0755)
 	if err != nil {
 		return err
 	}
 
-	// Write config file
+	// Write config file, unless another 0s is using it
+	if !configLocked {
+		unlock, err := lockConfig(true)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
 	err = ioutil.WriteFile(configFilePath, byteValue, 0644)
 	if err != nil {
 		return err
@@ -186,7 +754,65 @@ func saveConfig(config *Config) error {
 	return nil
 }
 
-func listRepositories(config *Config) {
+// marshalConfig returns config as written in a file, with the paths left
+// unchanged as they were written and the passwords encrypted if a master
+// key is available.
+func marshalConfig(config *Config) ([]byte, error) {
+	homeDir, _ := os.UserHomeDir()
+	written := *config
+	if config.picked != "" && config.Current == config.picked {
+		written.Current = config.saved
+	}
+	written.Repositories = make(map[string]Repository, len(config.Repositories))
+	for name, repo := range config.Repositories {
+		unexpandRepositoryPaths(&repo, homeDir)
+		written.Repositories[name] = repo
+	}
+
+	// Encrypt the passwords if a master key is available
+	config, err := encryptRepositories(&written)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting passwords: %w", err)
+	}
+
+	// Marshal JSON
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// currentRepo returns the repository commands work on, the current one of
+// config or the one picked with --repo.
+func currentRepo(config *Config) Repository {
+	return config.Repositories[config.Current]
+}
+
+// pickRepository makes name the current repository of config for one
+// command, as --repo asks, without saving it as such. It returns the
+// function putting back the previous one, unless the command changed it.
+func pickRepository(config *Config, name string) (func(), error) {
+	if _, ok := config.Repositories[name]; !ok {
+		return nil, configError(fmt.Errorf("repository '%s' not found", name))
+	}
+
+	previous := *config
+	if config.picked == "" {
+		config.saved = config.Current
+	}
+	config.picked, config.Current = name, name
+
+	return func() {
+		if config.Current == name {
+			config.Current, config.picked, config.saved = previous.Current, previous.picked, previous.saved
+		} else {
+			config.picked = ""
+		}
+	}, nil
+}
+
+func listRepositories(config *Config) error {
+	if *jsonFlag {
+		return printRepositoriesJSON(config)
+	}
+
 	fmt.Println("Available repositories:")
 	for name, repo := range config.Repositories {
 		if name == config.Current {
@@ -195,13 +821,121 @@ func listRepositories(config *Config) {
 			fmt.Printf("   %s (%s, %s)\n", name, repo.Type, repo.Path)
 		}
 	}
+
+	return nil
+}
+
+// repositoryJSON is the JSON form of a repository printed by 'list --json',
+// telling whether secrets are set instead of showing them.
+type repositoryJSON struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	Current       bool   `json:"current"`
+	Path          string `json:"path,omitempty"`
+	Host          string `json:"host,omitempty"`
+	Port          uint   `json:"port,omitempty"`
+	User          string `json:"user,omitempty"`
+	SSHHost       string `json:"ssh_host,omitempty"`
+	Bucket        string `json:"bucket,omitempty"`
+	Region        string `json:"region,omitempty"`
+	Endpoint      string `json:"endpoint,omitempty"`
+	Credentials   string `json:"credentials_file,omitempty"`
+	Fingerprint   string `json:"host_key_fingerprint,omitempty"`
+	AccountName   string `json:"account_name,omitempty"`
+	Container     string `json:"container,omitempty"`
+	DownloadDir   string `json:"download_dir,omitempty"`
+	Compress      bool   `json:"compress,omitempty"`
+	Proxy         string `json:"proxy,omitempty"`
+	Jump          string `json:"jump,omitempty"`
+	HasPassword   bool   `json:"has_password"`
+	HasPrivateKey bool   `json:"has_private_key"`
+	HasPassphrase bool   `json:"has_passphrase"`
+	HasSecretKey  bool   `json:"has_secret_key"`
+	HasAccountKey bool   `json:"has_account_key"`
+}
+
+func printRepositoriesJSON(config *Config) error {
+	var names []string
+	for name := range config.Repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	repos := []repositoryJSON{}
+	for _, name := range names {
+		repo := config.Repositories[name]
+		repos = append(repos, repositoryJSON{
+			Name:          name,
+			Type:          repo.Type,
+			Current:       name == config.Current,
+			Path:          repo.Path,
+			Host:          repo.Host,
+			Port:          repo.Port,
+			User:          repo.User,
+			SSHHost:       repo.SSHHost,
+			Bucket:        repo.Bucket,
+			Region:        repo.Region,
+			Endpoint:      repo.Endpoint,
+			Credentials:   repo.CredentialsFile,
+			Fingerprint:   repo.HostKeyFingerprint,
+			AccountName:   repo.AccountName,
+			Container:     repo.Container,
+			DownloadDir:   repo.DownloadDir,
+			Compress:      repo.Compress,
+			Proxy:         redactProxy(repo.Proxy),
+			Jump:          describeJump(repo.Jump),
+			HasPassword:   repo.Password != "",
+			HasPrivateKey: repo.PrivateKey != "",
+			HasPassphrase: repo.Passphrase != "",
+			HasSecretKey:  repo.SecretKey != "",
+			HasAccountKey: repo.AccountKey != "",
+		})
+	}
+
+	byteValue, err := json.MarshalIndent(repos, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(byteValue))
+	return nil
+}
+
+// describeJump returns the user@host:port of a jump host, if any.
+func describeJump(jump *Repository) string {
+	switch {
+	case jump == nil:
+		return ""
+	case jump.Host == "":
+		return jump.SSHHost
+	case jump.Port == 0:
+		return fmt.Sprintf("%s@%s", jump.User, jump.Host)
+	}
+	return fmt.Sprintf("%s@%s", jump.User, net.JoinHostPort(jump.Host, fmt.Sprint(jump.Port)))
+}
+
+// normalizeHost takes the brackets off an IPv6 literal host of repo, as in
+// [::1], and moves the port given along with the host, as in host:2222 or
+// [::1]:2222, to the port setting unless that one is set.
+func normalizeHost(repo *Repository) {
+	host, port, err := net.SplitHostPort(repo.Host)
+	if err == nil {
+		if number, err := strconv.ParseUint(port, 10, 16); err == nil {
+			repo.Host = host
+			if repo.Port == 0 {
+				repo.Port = uint(number)
+			}
+			return
+		}
+	}
+	if strings.HasPrefix(repo.Host, "[") && strings.HasSuffix(repo.Host, "]") {
+		repo.Host = repo.Host[1 : len(repo.Host)-1]
+	}
 }
 
-func setRepository(config *Config, name string) {
+func setRepository(config *Config, name string) error {
 	// Check if repository exists
 	if _, ok := config.Repositories[name]; !ok {
-		fmt.Printf("Repository '%s' not found.\n", name)
-		os.Exit(1)
+		return configError(fmt.Errorf("repository '%s' not found", name))
 	}
 
 	// Set current repository
@@ -210,367 +944,4491 @@ func setRepository(config *Config, name string) {
 	// Save config
 	err := saveConfig(config)
 	if err != nil {
-		fmt.Println("Error saving configuration:", err)
-		os.Exit(1)
+		return configError(fmt.Errorf("cannot save configuration: %w", err))
 	}
 
-	fmt.Printf("Current repository set to '%s'.\n", name)
+	infof("Current repository set to '%s'.\n", name)
+
+	return nil
 }
 
-func showRepository(config *Config) {
-	// Get current repository
-	repo := config.Repositories[config.Current]
+func addRepository(config *Config, args []string) error {
+	name, repoType := args[0], args[1]
 
-	// Check repository type
-	switch repo.Type {
+	// Check if repository already exists
+	if _, ok := config.Repositories[name]; ok && !*forceFlag {
+		return configError(fmt.Errorf("repository '%s' already exists, use --force to replace it", name))
+	}
+
+	repo := Repository{
+		Name:       name,
+		Type:       repoType,
+		Path:       *pathFlag,
+		Host:       *hostFlag,
+		Port:       *portFlag,
+		User:       *userFlag,
+		PrivateKey: *keyFlag,
+		Password:   *passwordFlag,
+		SSHHost:    *sshHostFlag,
+		ShareURL:   *shareFlag,
+		Domain:     *domainFlag,
+		Root:       *rootFlag,
+	}
+
+	// Fill in the optional positional argument and type defaults
+	switch repoType {
 	case "local", "network":
-		// List files and folders
-		files, err := ioutil.ReadDir(repo.Path)
+		if repo.Path == "" && len(args) > 2 {
+			repo.Path = args[2]
+		}
+		// A network share may be reached over SMB only
+		if repo.Path == "" && repo.ShareURL != "" && repoType == "network" {
+			break
+		}
+		if repo.Path == "" {
+			return usageError(fmt.Errorf("please specify a path for the '%s' repository", repoType))
+		}
+		// UNC paths are absolute, and kept as given for SMB
+		if repoType == "network" && uncRoot(repo.Path) != "" {
+			break
+		}
+		absPath, err := filepath.Abs(repo.Path)
 		if err != nil {
-			fmt.Println("Error reading repository:", err)
-			os.Exit(1)
+			return transferError(fmt.Errorf("cannot get absolute path: %w", err))
 		}
-
-		for _, file := range files {
-			if file.IsDir() {
-				fmt.Printf("%s/\n", file.Name())
-			} else {
-				fmt.Println(file.Name())
+		repo.Path = absPath
+		if repo.Root != "" {
+			absRoot, err := filepath.Abs(repo.Root)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get absolute path: %w", err))
 			}
+			repo.Root = absRoot
 		}
-	case "ssh":
-		// Get SSH client
-		client, err := getSSHClient(&repo)
-		if err != nil {
-			fmt.Println("Error connecting to SSH server:", err)
-			os.Exit(1)
+	case "ssh", "ftp":
+		if repo.Host == "" && len(args) > 2 {
+			repo.Host = args[2]
 		}
-		defer client.Close()
+		normalizeHost(&repo)
+		if repo.Host == "" && (repo.SSHHost == "" || repoType != "ssh") {
+			return usageError(fmt.Errorf("please specify a host for the '%s' repository", repoType))
+		}
+		if repo.Port > 65535 {
+			return usageError(fmt.Errorf("invalid port %d, expected 1 to 65535", repo.Port))
+		}
+		// Let ~/.ssh/config provide the port of an SSH host
+		if repo.Port == 0 && repoType == "ssh" && repo.SSHHost == "" {
+			repo.Port = 22
+		} else if repo.Port == 0 && repoType == "ftp" {
+			repo.Port = 21
+		}
+	default:
+		return usageError(fmt.Errorf("unknown repository type '%s'", repoType))
+	}
+
+	// Add repository
+	config.Repositories[name] = repo
+
+	// Save config
+	err := saveConfig(config)
+	if err != nil {
+		return configError(fmt.Errorf("cannot save configuration: %w", err))
+	}
+
+	infof("Repository '%s' added.\n", name)
+
+	return nil
+}
+
+func renameRepository(config *Config, oldName, newName string) error {
+	// Check if repositories exist
+	repo, ok := config.Repositories[oldName]
+	if !ok {
+		return configError(fmt.Errorf("repository '%s' not found", oldName))
+	}
+	if oldName == newName {
+		return usageError(fmt.Errorf("repository '%s' already has this name", oldName))
+	}
+	if _, ok := config.Repositories[newName]; ok && !*forceFlag {
+		return configError(fmt.Errorf("repository '%s' already exists, use --force to replace it", newName))
+	}
+
+	// Move repository
+	repo.Name = newName
+	config.Repositories[newName] = repo
+	delete(config.Repositories, oldName)
+	if config.Current == oldName {
+		config.Current = newName
+	}
+
+	// Save config
+	err := saveConfig(config)
+	if err != nil {
+		return configError(fmt.Errorf("cannot save configuration: %w", err))
+	}
+
+	// Keep mirrored directories from starting over
+	err = renameMirrorBaselines(oldName, newName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot update mirror baselines: %v\n", err)
+	}
+
+	infof("Repository '%s' renamed to '%s'.\n", oldName, newName)
+	return nil
+}
+
+// copyRepository adds the repository dst with the settings of src, except
+// for those given on the command line as with 'add'.
+func copyRepository(config *Config, src, dst string) error {
+	// Check if repositories exist
+	repo, ok := config.Repositories[src]
+	if !ok {
+		return configError(fmt.Errorf("repository '%s' not found", src))
+	}
+	if _, ok := config.Repositories[dst]; ok && !*forceFlag {
+		return configError(fmt.Errorf("repository '%s' already exists, use --force to replace it", dst))
+	}
+
+	// The jump host is the only setting not held by value
+	if repo.Jump != nil {
+		jump := *repo.Jump
+		repo.Jump = &jump
+	}
+	repo.Name = dst
+	if *pathFlag != "" {
+		repo.Path = *pathFlag
+		if repo.Type == "local" || repo.Type == "network" {
+			absPath, err := filepath.Abs(repo.Path)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+			}
+			repo.Path = absPath
+		}
+	}
+	if *hostFlag != "" {
+		repo.Host = *hostFlag
+		// A port given along with the host replaces the copied one
+		if _, _, err := net.SplitHostPort(repo.Host); err == nil {
+			repo.Port = 0
+		}
+	}
+	if *portFlag != 0 {
+		repo.Port = *portFlag
+	}
+	normalizeHost(&repo)
+	if *userFlag != "" {
+		repo.User = *userFlag
+	}
+	if *keyFlag != "" {
+		repo.PrivateKey = *keyFlag
+	}
+	if *passwordFlag != "" {
+		repo.Password = *passwordFlag
+	}
+	if *sshHostFlag != "" {
+		repo.SSHHost = *sshHostFlag
+	}
+	if *shareFlag != "" {
+		repo.ShareURL = *shareFlag
+	}
+	if *domainFlag != "" {
+		repo.Domain = *domainFlag
+	}
+	if *rootFlag != "" {
+		repo.Root = *rootFlag
+	}
+	config.Repositories[dst] = repo
+
+	// Save config
+	err := saveConfig(config)
+	if err != nil {
+		return configError(fmt.Errorf("cannot save configuration: %w", err))
+	}
+
+	infof("Repository '%s' copied to '%s'.\n", src, dst)
+	return nil
+}
+
+func deleteRepository(config *Config, name string) error {
+	// Check if repository exists
+	if _, ok := config.Repositories[name]; !ok {
+		return configError(fmt.Errorf("repository '%s' not found", name))
+	}
+
+	// Remove repository
+	delete(config.Repositories, name)
+
+	// Switch to another repository if the current one was removed
+	if config.Current == name {
+		config.Current = ""
+		names := make([]string, 0, len(config.Repositories))
+		for other := range config.Repositories {
+			names = append(names, other)
+		}
+		if len(names) > 0 {
+			sort.Strings(names)
+			config.Current = names[0]
+		}
+	}
+
+	// Save config
+	err := saveConfig(config)
+	if err != nil {
+		return configError(fmt.Errorf("cannot save configuration: %w", err))
+	}
+
+	infof("Repository '%s' removed.\n", name)
+	if config.Current != "" {
+		infof("Current repository is '%s'.\n", config.Current)
+	} else {
+		infof("No repository left, use 'add' to create one.\n")
+	}
+
+	return nil
+}
+
+func printWorkingDirectory(config *Config) {
+	// Get current repository
+	repo := currentRepo(config)
+
+	switch repo.Type {
+	case "ssh", "ftp":
+		host := repo.Host
+		if host == "" {
+			host = repo.SSHHost
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		fmt.Printf("%s (%s): %s:%s\n", config.Current, repo.Type, host, repo.Path)
+	case "s3":
+		fmt.Printf("%s (%s): s3://%s/%s\n", config.Current, repo.Type, repo.Bucket, objectKey(repo.Path, ""))
+	case "gcs":
+		fmt.Printf("%s (%s): gs://%s/%s\n", config.Current, repo.Type, repo.Bucket, objectKey(repo.Path, ""))
+	case "azureblob":
+		fmt.Printf("%s (%s): azure://%s/%s/%s\n", config.Current, repo.Type, repo.AccountName, repo.Container, objectKey(repo.Path, ""))
+	case "network":
+		if useSMB(&repo) {
+			fmt.Printf("%s (%s): %s\n", config.Current, repo.Type, smbShareURL(&repo))
+		} else {
+			fmt.Printf("%s (%s): %s\n", config.Current, repo.Type, repo.Path)
+		}
+	default:
+		fmt.Printf("%s (%s): %s\n", config.Current, repo.Type, repo.Path)
+	}
+}
+
+func showRepository(config *Config) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	switch *sortFlag {
+	case "name", "size", "time":
+	default:
+		return usageError(fmt.Errorf("invalid sort '%s', use name, size or time", *sortFlag))
+	}
+
+	if *recursiveFlag {
+		return showRecursive(&repo)
+	}
+
+	files, err := listFiles(&repo)
+	if err != nil {
+		return err
+	}
+
+	sortFiles(files, true)
+	for _, file := range files {
+		printFileInfo(file)
+	}
+
+	return nil
+}
+
+// showRecursive lists the whole tree below the current directory of repo,
+// as ls -R, each entry by its path relative to the directory, sorted.
+func showRecursive(repo *Repository) error {
+	entries := map[string]os.FileInfo{}
+
+	switch repo.Type {
+	case "local", "network":
+		if useSMB(repo) {
+			return usageError(fmt.Errorf("'show --recursive' not implemented yet for shares reached over SMB"))
+		}
+		err := filepath.Walk(repo.Path, func(itemPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(repo.Path, itemPath)
+			if err != nil || relPath == "." {
+				return err
+			}
+			entries[filepath.ToSlash(relPath)] = info
+			return nil
+		})
+		if err != nil {
+			return transferError(fmt.Errorf("cannot walk repository: %w", err))
+		}
+	case "ssh":
+		// Get SSH client
+		client, err := getSSHClient(repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		rootPath := filepath.ToSlash(repo.Path)
+		walker := sftp.Walk(rootPath)
+		for walker.Step() {
+			if walker.Err() != nil {
+				return transferError(fmt.Errorf("cannot walk remote directory: %w", walker.Err()))
+			}
+			relPath := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), rootPath), "/")
+			if relPath != "" {
+				entries[relPath] = walker.Stat()
+			}
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'show --recursive'", repo.Type))
+	}
+
+	var files []os.FileInfo
+	for relPath, info := range entries {
+		files = append(files, namedInfo{FileInfo: info, name: relPath})
+	}
+	sortFiles(files, false)
+	for _, file := range files {
+		printFileInfo(file)
+	}
+
+	return nil
+}
+
+// namedInfo is a file listed under another name than its own, such as its
+// relative path.
+type namedInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (n namedInfo) Name() string { return n.name }
+
+// sortFiles orders files by name, the contents of a directory coming right
+// after it, or with --sort by size or time, the largest or most recent
+// first. Directories come first if dirsFirst is set, --reverse reversing
+// the order within them and within files.
+func sortFiles(files []os.FileInfo, dirsFirst bool) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if dirsFirst && a.IsDir() != b.IsDir() {
+			return a.IsDir()
+		}
+		if *reverseFlag {
+			a, b = b, a
+		}
+		switch {
+		case *sortFlag == "size" && a.Size() != b.Size():
+			return a.Size() > b.Size()
+		case *sortFlag == "time" && !a.ModTime().Equal(b.ModTime()):
+			return a.ModTime().After(b.ModTime())
+		}
+		return strings.ReplaceAll(a.Name(), "/", "\x00") < strings.ReplaceAll(b.Name(), "/", "\x00")
+	})
+}
+
+// listFiles returns the files and folders in the current directory of repo.
+func listFiles(repo *Repository) ([]os.FileInfo, error) {
+	// Check repository type
+	switch repo.Type {
+	case "local", "network":
+		// Shares that are not mounted are reached over SMB
+		if useSMB(repo) {
+			share, err := getSMBShare(repo)
+			if err != nil {
+				return nil, connectionError(fmt.Errorf("cannot connect to SMB share: %w", err))
+			}
+			defer share.Close()
+
+			files, err := share.ReadDir(share.path(""))
+			if err != nil {
+				return nil, transferError(fmt.Errorf("cannot read remote directory: %w", err))
+			}
+			return files, nil
+		}
+
+		// List files and folders
+		files, err := ioutil.ReadDir(repo.Path)
+		if err != nil {
+			return nil, transferError(fmt.Errorf("cannot read repository: %w", err))
+		}
+
+		return files, nil
+	case "ssh":
+		// Get SSH client
+		client, err := getSSHClient(repo)
+		if err != nil {
+			return nil, connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
 
 		// Get SFTP client
 		sftp, err := client.NewSftp()
 		if err != nil {
-			fmt.Println("Error creating SFTP client:", err)
-			os.Exit(1)
+			return nil, connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
 		}
 		defer sftp.Close()
 
 		// List files
 		files, err := sftp.ReadDir(repo.Path)
 		if err != nil {
-			fmt.Println("Error reading remote directory:", err)
-			os.Exit(1)
+			return nil, transferError(fmt.Errorf("cannot read remote directory: %w", err))
 		}
 
-		for _, file := range files {
-			if file.IsDir() {
-				fmt.Printf("%s/\n", file.Name())
-			} else {
-				fmt.Println(file.Name())
-			}
+		return files, nil
+	case "s3":
+		// Get S3 client
+		client, err := getS3Client(repo)
+		if err != nil {
+			return nil, connectionError(fmt.Errorf("cannot create S3 client: %w", err))
+		}
+
+		// List objects under the current prefix
+		files, err := listS3Directory(client, repo.Bucket, objectKey(repo.Path, ""))
+		if err != nil {
+			return nil, transferError(fmt.Errorf("cannot list bucket: %w", err))
+		}
+
+		return files, nil
+	case "gcs":
+		// Get GCS client
+		client, err := getGCSClient(repo)
+		if err != nil {
+			return nil, connectionError(fmt.Errorf("cannot create GCS client: %w", err))
+		}
+		defer client.Close()
+
+		// List objects under the current prefix
+		files, err := listGCSDirectory(client, repo.Bucket, objectKey(repo.Path, ""))
+		if err != nil {
+			return nil, transferError(fmt.Errorf("cannot list bucket: %w", err))
+		}
+
+		return files, nil
+	case "azureblob":
+		// Get Azure client
+		client, err := getAzureClient(repo)
+		if err != nil {
+			return nil, connectionError(fmt.Errorf("cannot create Azure client: %w", err))
+		}
+
+		// List blobs under the current prefix
+		files, err := listAzureDirectory(client, repo, objectKey(repo.Path, ""))
+		if err != nil {
+			return nil, transferError(fmt.Errorf("cannot list container: %w", err))
+		}
+
+		return files, nil
+	case "ftp":
+		// Get FTP client
+		client, err := getFTPClient(repo)
+		if err != nil {
+			return nil, connectionError(fmt.Errorf("cannot connect to FTP server: %w", err))
 		}
+		defer client.Quit()
 
+		// List files
+		files, err := listFTPDirectory(client, repo.Path)
+		if err != nil {
+			return nil, transferError(fmt.Errorf("cannot read remote directory: %w", err))
+		}
+
+		return files, nil
 	default:
-		fmt.Printf("Repository type '%s' not implemented yet.\n", repo.Type)
+		return nil, usageError(fmt.Errorf("repository type '%s' not implemented yet", repo.Type))
+	}
+}
+
+// printFileInfo prints one line of a directory listing, similar to ls -lh.
+func printFileInfo(file os.FileInfo) {
+	name := file.Name()
+	size := humanizeBytes(file.Size())
+	if file.IsDir() {
+		name += "/"
+		size = "-"
+	}
+	modTime := file.ModTime().Format("2006-01-02 15:04")
+	if file.ModTime().IsZero() {
+		modTime = strings.Repeat(" ", len(modTime))
+	}
+	fmt.Printf("%s %7s  %s  %s\n", file.Mode(), size, modTime, name)
+}
+
+// objectInfo describes an entry of a repository whose client library has no
+// os.FileInfo of its own (object stores, FTP) so it can be listed like a file.
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (o objectInfo) Name() string       { return o.name }
+func (o objectInfo) Size() int64        { return o.size }
+func (o objectInfo) ModTime() time.Time { return o.modTime }
+func (o objectInfo) IsDir() bool        { return o.dir }
+func (o objectInfo) Sys() interface{}   { return nil }
+
+func (o objectInfo) Mode() os.FileMode {
+	if o.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// humanizeBytes formats a size in bytes using binary units, e.g. 1.2M.
+func humanizeBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	value := float64(size) / float64(div)
+	if value < 10 {
+		return fmt.Sprintf("%.1f%c", value, "KMGTPE"[exp])
 	}
+	return fmt.Sprintf("%.0f%c", value, "KMGTPE"[exp])
 }
 
-func getRepository(config *Config, name string) {
+func getRepository(config *Config, name string) error {
 	// Get current repository
-	repo := config.Repositories[config.Current]
+	repo := currentRepo(config)
+
+	// Stream the file as is, nothing is written locally
+	if *stdoutFlag {
+		return getStdout(config, name)
+	}
 
 	switch repo.Type {
 	case "local", "network":
-		// Get source and destination paths
-		srcPath := filepath.Join(repo.Path, name)
-		destPath, err := os.Getwd()
-		if err != nil {
-			fmt.Println("Error getting current directory:", err)
-			os.Exit(1)
+		// Shares that are not mounted are reached over SMB
+		if useSMB(&repo) {
+			return getSMBRepository(&repo, name)
 		}
-		destPath = filepath.Join(destPath, name)
 
-		// Copy file or folder
-		err = copy(srcPath, destPath)
+		// Expand wildcards against the repository
+		names := []string{name}
+		if isGlob(name) && !exists(os.Lstat, filepath.Join(repo.Path, name)) {
+			var err error
+			names, err = expandGlob(filepath.Glob, repo.Path, filepath.Join(repo.Path, name))
+			if err != nil {
+				return transferError(err)
+			}
+		}
+
+		workDir, err := getDownloadDir(&repo)
 		if err != nil {
-			fmt.Println("Error getting file or folder:", err)
-			os.Exit(1)
+			return transferError(fmt.Errorf("cannot get download directory: %w", err))
+		}
+
+		for _, name := range names {
+			// Get source and destination paths
+			srcPath := filepath.Join(repo.Path, name)
+			destPath := filepath.Join(workDir, name)
+
+			// Copy file or folder
+			err = copy(srcPath, destPath)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get file or folder: %w", err))
+			}
 		}
 	case "ssh":
 		// Get SSH client
 		client, err := getSSHClient(&repo)
 		if err != nil {
-			fmt.Println("Error connecting to SSH server:", err)
-			os.Exit(1)
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
 		}
 		defer client.Close()
 
 		sftp, err := client.NewSftp()
 		if err != nil {
-			fmt.Println("Error creating SFTP client:", err)
-			os.Exit(1)
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
 		}
 		defer sftp.Close()
 
-		// Get remote and local paths
-		remotePath := filepath.ToSlash(filepath.Join(repo.Path, name))
-		localPath, err := os.Getwd()
+		// Expand wildcards against the remote repository
+		names := []string{name}
+		if isGlob(name) && !exists(sftp.Lstat, sshPath(&repo, name)) {
+			names, err = expandGlob(sftp.Glob, repo.Path, sshPath(&repo, name))
+			if err != nil {
+				return transferError(err)
+			}
+		}
+
+		workDir, err := getDownloadDir(&repo)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot get download directory: %w", err))
+		}
+
+		for _, name := range names {
+			// Get remote and local paths
+			remotePath := sshPath(&repo, name)
+			localPath := filepath.Join(workDir, name)
+
+			// Check if remote path is a directory, a file or a link, with
+			// Lstat so that links are recreated as such, and with Stat
+			// under --follow-symlinks so that what they point to is got
+			stat := sftp.Lstat
+			if *followFlag {
+				stat = sftp.Stat
+			}
+			remoteStat, err := stat(remotePath)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get remote file info: %w", err))
+			}
+
+			switch {
+			case remoteStat.Mode()&os.ModeSymlink != 0:
+				err = downloadLink(sftp, remotePath, localPath)
+			case remoteStat.IsDir():
+				pool := newSFTPPool(client, sftp)
+				err = downloadDirectory(pool, remotePath, localPath, repo.Path)
+				pool.Close()
+			case useGzip(&repo):
+				err = downloadGzipFile(client, sftp, remotePath, localPath)
+			default:
+				err = downloadFile(sftp, remotePath, localPath, true)
+			}
+
+			if err != nil {
+				return transferError(fmt.Errorf("'get' failed: %w", err))
+			}
+		}
+	case "s3":
+		// Get S3 client
+		client, err := getS3Client(&repo)
 		if err != nil {
-			fmt.Println("Error getting current directory:", err)
-			os.Exit(1)
+			return connectionError(fmt.Errorf("cannot create S3 client: %w", err))
+		}
+
+		// Get object key and local path
+		key := objectKey(repo.Path, name)
+		localPath, err := getDownloadDir(&repo)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot get download directory: %w", err))
 		}
 		localPath = filepath.Join(localPath, name)
 
-		// Check if remote path is a directory or a file
-		remoteStat, err := sftp.Stat(remotePath)
-		if err != nil {
-			fmt.Printf("Error getting remote file info: %v\n", err)
-			os.Exit(1)
-		}
+		// Check if the key is a prefix or a single object
+		isDir, err := isS3Directory(client, repo.Bucket, key)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot list bucket: %w", err))
+		}
+
+		if isDir {
+			err = downloadS3Directory(client, repo.Bucket, key, localPath)
+		} else {
+			err = downloadS3Object(client, repo.Bucket, key, localPath)
+		}
+
+		if err != nil {
+			return transferError(fmt.Errorf("'get' failed: %w", err))
+		}
+	case "gcs":
+		// Get GCS client
+		client, err := getGCSClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create GCS client: %w", err))
+		}
+		defer client.Close()
+
+		// Get object key and local path
+		key := objectKey(repo.Path, name)
+		localPath, err := getDownloadDir(&repo)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot get download directory: %w", err))
+		}
+		localPath = filepath.Join(localPath, name)
+
+		// Check if the key is a prefix or a single object
+		isDir, err := isGCSDirectory(client, repo.Bucket, key)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot list bucket: %w", err))
+		}
+
+		if isDir {
+			err = downloadGCSDirectory(client, repo.Bucket, key, localPath)
+		} else {
+			err = downloadGCSObject(client, repo.Bucket, key, localPath)
+		}
+
+		if err != nil {
+			return transferError(fmt.Errorf("'get' failed: %w", err))
+		}
+	case "azureblob":
+		// Get Azure client
+		client, err := getAzureClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create Azure client: %w", err))
+		}
+
+		// Get blob name and local path
+		key := objectKey(repo.Path, name)
+		localPath, err := getDownloadDir(&repo)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot get download directory: %w", err))
+		}
+		localPath = filepath.Join(localPath, name)
+
+		// Check if the name is a prefix or a single blob
+		isDir, err := isAzureDirectory(client, &repo, key)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot list container: %w", err))
+		}
+
+		if isDir {
+			err = downloadAzureDirectory(client, &repo, key, localPath)
+		} else {
+			err = downloadAzureBlob(client, &repo, key, localPath)
+		}
+
+		if err != nil {
+			return transferError(fmt.Errorf("'get' failed: %w", err))
+		}
+	case "ftp":
+		// Get FTP client
+		client, err := getFTPClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to FTP server: %w", err))
+		}
+		defer client.Quit()
+
+		// Get remote and local paths
+		remotePath := ftpPath(&repo, name)
+		localPath, err := getDownloadDir(&repo)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot get download directory: %w", err))
+		}
+		localPath = filepath.Join(localPath, name)
+
+		// Check if remote path is a directory or a file
+		if isFTPDirectory(client, remotePath) {
+			err = downloadFTPDirectory(client, remotePath, localPath)
+		} else {
+			err = downloadFTPFile(client, remotePath, localPath)
+		}
+
+		if err != nil {
+			return transferError(fmt.Errorf("'get' failed: %w", err))
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'get'", repo.Type))
+	}
+
+	return nil
+}
+
+func putRepository(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Content piped on stdin, name being the destination only
+	if *stdinFlag {
+		return putStdin(&repo, name)
+	}
+
+	// Expand wildcards against the working directory
+	names := []string{name}
+	if isGlob(name) && !exists(os.Lstat, name) {
+		var err error
+		names, err = expandGlob(filepath.Glob, ".", name)
+		if err != nil {
+			return transferError(err)
+		}
+	}
+
+	switch repo.Type {
+	case "local", "network":
+		// Shares that are not mounted are reached over SMB
+		if useSMB(&repo) {
+			return putSMBRepository(&repo, names)
+		}
+
+		for _, name := range names {
+			// Get source and destination paths
+			srcPath, err := filepath.Abs(name)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+			}
+			destPath := filepath.Join(repo.Path, name)
+
+			// Make the missing parents of a nested destination
+			if *parentsFlag && !*dryRunFlag {
+				err = os.MkdirAll(filepath.Dir(destPath), 0755)
+				if err != nil {
+					return transferError(fmt.Errorf("cannot create parent directories: %w", err))
+				}
+			}
+
+			// Copy file or folder
+			err = copy(srcPath, destPath)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot put file or folder: %w", err))
+			}
+		}
+	case "ssh":
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		for _, name := range names {
+			// Get local and remote paths
+			localPath, err := filepath.Abs(name)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+			}
+			remotePath := sshPath(&repo, name)
+
+			// Check if local path is a directory or a file
+			localStat, err := os.Stat(localPath)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get local file info: %w", err))
+			}
+
+			// Make the missing parents of a nested destination
+			if *parentsFlag && !*dryRunFlag {
+				err = sftp.MkdirAll(path.Dir(remotePath))
+				if err != nil {
+					return transferError(fmt.Errorf("cannot create remote parent directories: %w", err))
+				}
+			}
+
+			switch {
+			case localStat.IsDir():
+				err = uploadDirectory(sftp, localPath, remotePath, repo.Path)
+			case useGzip(&repo):
+				err = uploadGzipFile(client, sftp, localPath, remotePath)
+			default:
+				err = uploadFile(sftp, localPath, remotePath)
+			}
+
+			if err != nil {
+				return transferError(fmt.Errorf("'put' failed: %w", err))
+			}
+		}
+	case "s3":
+		// Get S3 client
+		client, err := getS3Client(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create S3 client: %w", err))
+		}
+
+		for _, name := range names {
+			// Get local path and object key
+			localPath, err := filepath.Abs(name)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+			}
+			key := objectKey(repo.Path, name)
+
+			// Check if local path is a directory or a file
+			localStat, err := os.Stat(localPath)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get local file info: %w", err))
+			}
+
+			if localStat.IsDir() {
+				err = uploadS3Directory(client, repo.Bucket, localPath, key)
+			} else {
+				err = uploadS3Object(client, repo.Bucket, localPath, key)
+			}
+
+			if err != nil {
+				return transferError(fmt.Errorf("'put' failed: %w", err))
+			}
+		}
+	case "gcs":
+		// Get GCS client
+		client, err := getGCSClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create GCS client: %w", err))
+		}
+		defer client.Close()
+
+		for _, name := range names {
+			// Get local path and object key
+			localPath, err := filepath.Abs(name)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+			}
+			key := objectKey(repo.Path, name)
+
+			// Check if local path is a directory or a file
+			localStat, err := os.Stat(localPath)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get local file info: %w", err))
+			}
+
+			if localStat.IsDir() {
+				err = uploadGCSDirectory(client, repo.Bucket, localPath, key)
+			} else {
+				err = uploadGCSObject(client, repo.Bucket, localPath, key)
+			}
+
+			if err != nil {
+				return transferError(fmt.Errorf("'put' failed: %w", err))
+			}
+		}
+	case "azureblob":
+		// Get Azure client
+		client, err := getAzureClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create Azure client: %w", err))
+		}
+
+		for _, name := range names {
+			// Get local path and blob name
+			localPath, err := filepath.Abs(name)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+			}
+			key := objectKey(repo.Path, name)
+
+			// Check if local path is a directory or a file
+			localStat, err := os.Stat(localPath)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get local file info: %w", err))
+			}
+
+			if localStat.IsDir() {
+				err = uploadAzureDirectory(client, &repo, localPath, key)
+			} else {
+				err = uploadAzureBlob(client, &repo, localPath, key)
+			}
+
+			if err != nil {
+				return transferError(fmt.Errorf("'put' failed: %w", err))
+			}
+		}
+	case "ftp":
+		// Get FTP client
+		client, err := getFTPClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to FTP server: %w", err))
+		}
+		defer client.Quit()
+
+		for _, name := range names {
+			// Get local and remote paths
+			localPath, err := filepath.Abs(name)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+			}
+			remotePath := ftpPath(&repo, name)
+
+			// Check if local path is a directory or a file
+			localStat, err := os.Stat(localPath)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot get local file info: %w", err))
+			}
+
+			if localStat.IsDir() {
+				err = uploadFTPDirectory(client, localPath, remotePath)
+			} else {
+				err = uploadFTPFile(client, localPath, remotePath)
+			}
+
+			if err != nil {
+				return transferError(fmt.Errorf("'put' failed: %w", err))
+			}
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'put'", repo.Type))
+	}
+
+	return nil
+}
+
+func removeRepository(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	switch repo.Type {
+	case "local", "network":
+		// Get target path, making sure it stays inside the repository
+		targetPath, err := resolvePath(&repo, name)
+		if err != nil {
+			return usageError(err)
+		}
+		if targetPath == filepath.Clean(repo.Path) {
+			return usageError(errors.New("refusing to remove the repository root"))
+		}
+
+		// Check that the target exists
+		info, err := os.Stat(targetPath)
+		if os.IsNotExist(err) {
+			return transferError(fmt.Errorf("'%s' does not exist", targetPath))
+		} else if err != nil {
+			return transferError(fmt.Errorf("cannot access path '%s': %w", targetPath, err))
+		}
+
+		// Directories need -r, and a confirmation on the terminal
+		if info.IsDir() {
+			if !*recursiveFlag {
+				return usageError(fmt.Errorf("'%s' is a directory, use -r", targetPath))
+			}
+			if !*dryRunFlag && needsConfirmation() {
+				count, err := countLocalFiles(targetPath)
+				if err != nil {
+					return transferError(fmt.Errorf("cannot walk file or folder: %w", err))
+				}
+				if !confirm(fmt.Sprintf("Delete %d files under %s?", count, targetPath)) {
+					fmt.Println("Aborted.")
+					return nil
+				}
+			}
+		}
+
+		// Only list what would be removed on a dry run
+		if *dryRunFlag {
+			err = filepath.Walk(targetPath, func(itemPath string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Would remove '%s'\n", itemPath)
+				return nil
+			})
+			if err != nil {
+				return transferError(fmt.Errorf("cannot walk file or folder: %w", err))
+			}
+			return nil
+		}
+
+		// Remove file or folder
+		err = os.RemoveAll(targetPath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot remove file or folder: %w", err))
+		}
+		infof("Removed '%s'\n", targetPath)
+	case "ssh":
+		// Get remote path, making sure it stays inside the repository
+		remotePath, err := resolvePath(&repo, name)
+		if err != nil {
+			return usageError(err)
+		}
+		if remotePath == filepath.Clean(repo.Path) {
+			return usageError(errors.New("refusing to remove the repository root"))
+		}
+		remotePath = filepath.ToSlash(remotePath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		// Check if remote path is a directory or a file
+		remoteStat, err := sftp.Stat(remotePath)
+		if os.IsNotExist(err) {
+			return transferError(fmt.Errorf("remote path '%s' does not exist", remotePath))
+		} else if err != nil {
+			return transferError(fmt.Errorf("cannot get remote file info: %w", err))
+		}
+
+		// Directories need -r, and a confirmation on the terminal
+		if remoteStat.IsDir() {
+			if !*recursiveFlag {
+				return usageError(fmt.Errorf("'%s' is a directory, use -r", remotePath))
+			}
+			if !*dryRunFlag && needsConfirmation() {
+				count, err := countRemoteFiles(sftp, remotePath)
+				if err != nil {
+					return transferError(fmt.Errorf("cannot walk remote directory: %w", err))
+				}
+				if !confirm(fmt.Sprintf("Delete %d files under %s?", count, remotePath)) {
+					fmt.Println("Aborted.")
+					return nil
+				}
+			}
+		}
+
+		if remoteStat.IsDir() {
+			err = removeRemoteDirectory(sftp, remotePath)
+		} else if *dryRunFlag {
+			fmt.Printf("Would remove '%s'\n", remotePath)
+			return nil
+		} else {
+			err = sftp.Remove(remotePath)
+		}
+
+		if err != nil {
+			return transferError(fmt.Errorf("'rm' failed: %w", err))
+		}
+		if !*dryRunFlag {
+			infof("Removed '%s'\n", remotePath)
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'rm'", repo.Type))
+	}
+
+	return nil
+}
+
+func moveRepository(config *Config, src, dst string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get source and destination paths, making sure both stay inside the repository
+	srcPath, err := resolvePath(&repo, src)
+	if err != nil {
+		return usageError(err)
+	}
+	dstPath, err := resolvePath(&repo, dst)
+	if err != nil {
+		return usageError(err)
+	}
+
+	switch repo.Type {
+	case "local", "network":
+		// Check that the source exists
+		_, err = os.Stat(srcPath)
+		if os.IsNotExist(err) {
+			return transferError(fmt.Errorf("'%s' does not exist", srcPath))
+		} else if err != nil {
+			return transferError(fmt.Errorf("cannot access path '%s': %w", srcPath, err))
+		}
+
+		// Check that the destination directory exists
+		dstDir := filepath.Dir(dstPath)
+		info, err := os.Stat(dstDir)
+		if err != nil || !info.IsDir() {
+			return transferError(fmt.Errorf("destination directory '%s' does not exist", dstDir))
+		}
+
+		// Rename file or folder
+		err = os.Rename(srcPath, dstPath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot move file or folder: %w", err))
+		}
+	case "ssh":
+		srcPath = filepath.ToSlash(srcPath)
+		dstPath = filepath.ToSlash(dstPath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		// Check that the source exists
+		_, err = sftp.Stat(srcPath)
+		if os.IsNotExist(err) {
+			return transferError(fmt.Errorf("remote path '%s' does not exist", srcPath))
+		} else if err != nil {
+			return transferError(fmt.Errorf("cannot get remote file info: %w", err))
+		}
+
+		// Check that the destination directory exists
+		dstDir := filepath.ToSlash(filepath.Dir(dstPath))
+		info, err := sftp.Stat(dstDir)
+		if err != nil || !info.IsDir() {
+			return transferError(fmt.Errorf("remote destination directory '%s' does not exist", dstDir))
+		}
+
+		// Rename remote file or folder
+		err = sftp.Rename(srcPath, dstPath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot move remote file or folder: %w", err))
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'mv'", repo.Type))
+	}
+
+	infof("Moved '%s' to '%s'\n", srcPath, dstPath)
+
+	return nil
+}
+
+// touchRepository creates the empty file name, or sets its modification time
+// to now if it exists.
+func touchRepository(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get file path, making sure it stays inside the repository
+	filePath, err := resolvePath(&repo, name)
+	if err != nil {
+		return usageError(err)
+	}
+	now := time.Now()
+
+	switch repo.Type {
+	case "local", "network":
+		if *dryRunFlag {
+			fmt.Printf("Would touch '%s'\n", filePath)
+			return nil
+		}
+
+		file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot create file: %w", err))
+		}
+		file.Close()
+
+		err = os.Chtimes(filePath, now, now)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot change modification time: %w", err))
+		}
+	case "ssh":
+		filePath = filepath.ToSlash(filePath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		if *dryRunFlag {
+			fmt.Printf("Would touch '%s'\n", filePath)
+			return nil
+		}
+
+		// Create the file unless it exists, without truncating it
+		_, err = sftp.Stat(filePath)
+		if os.IsNotExist(err) {
+			file, err := sftp.Create(filePath)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot create remote file: %w", err))
+			}
+			file.Close()
+		} else if err != nil {
+			return transferError(fmt.Errorf("cannot get remote file info: %w", err))
+		}
+
+		err = sftp.Chtimes(filePath, now, now)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot change modification time: %w", err))
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'touch'", repo.Type))
+	}
+
+	infof("Touched '%s'\n", filePath)
+	return nil
+}
+
+func catRepository(config *Config, name string) error {
+	return copyRepositoryFile(config, name, os.Stdout, "cat")
+}
+
+// copyRepositoryFile writes the contents of the repository file name to w,
+// command naming the caller in errors.
+func copyRepositoryFile(config *Config, name string, w io.Writer, command string) error {
+	return readRepositoryFile(config, name, command, func(r io.ReadSeeker, size int64) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// readRepositoryFile opens the repository file name and hands it to read
+// along with its size, command naming the caller in errors.
+func readRepositoryFile(config *Config, name, command string, read func(r io.ReadSeeker, size int64) error) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get file path, making sure it stays inside the repository
+	filePath, err := resolvePath(&repo, name)
+	if err != nil {
+		return usageError(err)
+	}
+
+	switch repo.Type {
+	case "local", "network":
+		// Check that the target is a file
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot access path '%s': %w", filePath, err))
+		}
+		if info.IsDir() {
+			return transferError(fmt.Errorf("'%s' is a directory", filePath))
+		}
+
+		// Open file
+		file, err := os.Open(filePath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot open file: %w", err))
+		}
+
+		err = read(file, info.Size())
+		file.Close()
+		if err != nil {
+			return transferError(fmt.Errorf("cannot read file: %w", err))
+		}
+	case "ssh":
+		filePath = filepath.ToSlash(filePath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		// Check that the target is a file
+		info, err := sftp.Stat(filePath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot access remote path '%s': %w", filePath, err))
+		}
+		if info.IsDir() {
+			return transferError(fmt.Errorf("remote path '%s' is a directory", filePath))
+		}
+
+		// Open remote file
+		remoteFile, err := sftp.Open(filePath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot open remote file: %w", err))
+		}
+
+		err = read(remoteFile, info.Size())
+		remoteFile.Close()
+		if err != nil {
+			return transferError(fmt.Errorf("cannot read remote file: %w", err))
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for '%s'", repo.Type, command))
+	}
+
+	return nil
+}
+
+// diffRepository compares the repository version of name with the local file
+// 'get' would write it to, printing a unified diff. It prints nothing if they
+// are the same.
+func diffRepository(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	workDir, err := getDownloadDir(&repo)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot get download directory: %w", err))
+	}
+	localPath := filepath.Join(workDir, name)
+	local, err := os.ReadFile(localPath)
+	if err != nil {
+		return usageError(fmt.Errorf("cannot read local file: %w", err))
+	}
+
+	// Fetch the repository version to a temporary file
+	tempFile, err := os.CreateTemp("", "0s-diff-*")
+	if err != nil {
+		return transferError(fmt.Errorf("cannot create temporary file: %w", err))
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	err = copyRepositoryFile(config, name, tempFile, "diff")
+	if err != nil {
+		return err
+	}
+	remote, err := os.ReadFile(tempFile.Name())
+	if err != nil {
+		return transferError(fmt.Errorf("cannot read temporary file: %w", err))
+	}
+
+	writeUnifiedDiff(os.Stdout, config.Current+":"+name, localPath, remote, local)
+	return nil
+}
+
+// editRepository fetches the repository file name to a temporary file, opens
+// it with $EDITOR and puts it back in place once the editor exits, unless it
+// failed or left the file unchanged.
+func editRepository(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get file path, making sure it stays inside the repository
+	filePath, err := resolvePath(&repo, name)
+	if err != nil {
+		return usageError(err)
+	}
+
+	// Fetch the file under its own name, for the editor to recognize it
+	tempDir, err := os.MkdirTemp("", "0s-edit-")
+	if err != nil {
+		return transferError(fmt.Errorf("cannot create temporary directory: %w", err))
+	}
+	defer os.RemoveAll(tempDir)
+	tempPath := filepath.Join(tempDir, filepath.Base(filePath))
+
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot create temporary file: %w", err))
+	}
+	err = copyRepositoryFile(config, name, tempFile, "edit")
+	tempFile.Close()
+	if err != nil {
+		return err
+	}
+
+	before, err := fileSum(tempPath)
+	if err != nil {
+		return transferError(err)
+	}
+
+	err = runEditor(tempPath)
+	if err != nil {
+		return fmt.Errorf("%w, '%s' left unchanged", err, name)
+	}
+
+	after, err := fileSum(tempPath)
+	if err != nil {
+		return transferError(err)
+	}
+	if after == before {
+		infof("No changes to '%s'\n", name)
+		return nil
+	}
+
+	switch repo.Type {
+	case "local", "network":
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot access path '%s': %w", filePath, err))
+		}
+
+		// Keep the permissions of the repository file
+		err = os.Chmod(tempPath, info.Mode().Perm())
+		if err != nil {
+			return transferError(fmt.Errorf("cannot set permissions: %w", err))
+		}
+		err = copy(tempPath, filePath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot put file: %w", err))
+		}
+	case "ssh":
+		filePath = filepath.ToSlash(filePath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		info, err := sftp.Stat(filePath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot access remote path '%s': %w", filePath, err))
+		}
+
+		// Keep the permissions of the remote file
+		err = os.Chmod(tempPath, info.Mode().Perm())
+		if err != nil {
+			return transferError(fmt.Errorf("cannot set permissions: %w", err))
+		}
+		err = uploadFile(sftp, tempPath, filePath)
+		if err != nil {
+			return transferError(fmt.Errorf("'edit' failed: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// runEditor opens file with $EDITOR, or vi (notepad on Windows) if it is not
+// set, and waits for it to exit.
+func runEditor(file string) error {
+	editor := os.Getenv("EDITOR")
+	if strings.TrimSpace(editor) == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// $EDITOR may hold arguments, such as "code --wait"
+	fields := strings.Fields(editor)
+	cmd := exec.Command(fields[0], append(fields[1:], file)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("editor '%s' failed: %v", editor, err)
+	}
+	return nil
+}
+
+// fileSum returns the hex encoded SHA-256 of the contents of a local file.
+func fileSum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("cannot open file: %w", err)
+	}
+	defer f.Close()
+	return sha256Sum(f)
+}
+
+func statRepository(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get target path, making sure it stays inside the repository
+	targetPath, err := resolvePath(&repo, name)
+	if err != nil {
+		return usageError(err)
+	}
+
+	switch repo.Type {
+	case "local", "network":
+		info, err := os.Stat(targetPath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot access path '%s': %w", targetPath, err))
+		}
+
+		printStat(targetPath, info)
+	case "ssh":
+		targetPath = filepath.ToSlash(targetPath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		info, err := sftp.Stat(targetPath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot access remote path '%s': %w", targetPath, err))
+		}
+
+		printStat(targetPath, info)
+		printSFTPStat(info)
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'stat'", repo.Type))
+	}
+
+	return nil
+}
+
+func findRepository(config *Config, pattern string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	if *typeFlag != "" && *typeFlag != "f" && *typeFlag != "d" {
+		return usageError(fmt.Errorf("invalid type '%s', use f or d", *typeFlag))
+	}
+	if isGlob(pattern) {
+		_, err := path.Match(pattern, "")
+		if err != nil {
+			return usageError(fmt.Errorf("invalid pattern '%s': %w", pattern, err))
+		}
+	}
+
+	switch repo.Type {
+	case "local", "network":
+		err := filepath.Walk(repo.Path, func(itemPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(repo.Path, itemPath)
+			if err != nil || relPath == "." {
+				return err
+			}
+
+			// Stop descending below --maxdepth
+			if *maxDepthFlag >= 0 && pathDepth(filepath.ToSlash(relPath)) > *maxDepthFlag {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if findMatch(info, pattern) && !skipFile(itemPath, info) {
+				fmt.Println(relPath)
+			}
+			return nil
+		})
+		if err != nil {
+			return transferError(fmt.Errorf("cannot walk repository: %w", err))
+		}
+	case "ssh":
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		rootPath := filepath.ToSlash(repo.Path)
+		walker := sftp.Walk(rootPath)
+		for walker.Step() {
+			if walker.Err() != nil {
+				return transferError(fmt.Errorf("cannot walk remote directory: %w", walker.Err()))
+			}
+			relPath := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), rootPath), "/")
+			if relPath == "" {
+				continue
+			}
+
+			// Stop descending below --maxdepth
+			if *maxDepthFlag >= 0 && pathDepth(relPath) > *maxDepthFlag {
+				if walker.Stat().IsDir() {
+					walker.SkipDir()
+				}
+				continue
+			}
+
+			if findMatch(walker.Stat(), pattern) && !skipFile(walker.Path(), walker.Stat()) {
+				fmt.Println(relPath)
+			}
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'find'", repo.Type))
+	}
+
+	return nil
+}
+
+func diskUsage(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get target path, making sure it stays inside the repository
+	targetPath, err := resolvePath(&repo, name)
+	if err != nil {
+		return usageError(err)
+	}
+
+	usage := usageTotals{entries: map[string]int64{}}
+
+	switch repo.Type {
+	case "local", "network":
+		err = filepath.Walk(targetPath, func(itemPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(targetPath, itemPath)
+			if err != nil {
+				return err
+			}
+			usage.add(filepath.ToSlash(relPath), info)
+			return nil
+		})
+		if err != nil {
+			return transferError(fmt.Errorf("cannot walk repository: %w", err))
+		}
+	case "ssh":
+		targetPath = filepath.ToSlash(targetPath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		walker := sftp.Walk(targetPath)
+		for walker.Step() {
+			if walker.Err() != nil {
+				return transferError(fmt.Errorf("cannot walk remote directory: %w", walker.Err()))
+			}
+			relPath := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), targetPath), "/")
+			if relPath == "" {
+				relPath = "."
+			}
+			usage.add(relPath, walker.Stat())
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'du'", repo.Type))
+	}
+
+	usage.print(targetPath)
+	return nil
+}
+
+// usageTotals sums the size of the files of a tree, in total and for each
+// top-level entry.
+type usageTotals struct {
+	total   int64
+	entries map[string]int64
+}
+
+// add accounts for the entry at relPath, a slash path relative to the root
+// of the tree ("." for the root itself).
+func (u *usageTotals) add(relPath string, info os.FileInfo) {
+	if relPath == "." {
+		// The root is a single file
+		if !info.IsDir() {
+			u.entries[info.Name()] += info.Size()
+			u.total += info.Size()
+		}
+		return
+	}
+
+	parts := strings.SplitN(relPath, "/", 2)
+	top := parts[0]
+	if len(parts) > 1 || info.IsDir() {
+		top += "/"
+	}
+	if info.IsDir() {
+		// Keep empty directories in the breakdown
+		if _, ok := u.entries[top]; !ok {
+			u.entries[top] = 0
+		}
+		return
+	}
+	u.entries[top] += info.Size()
+	u.total += info.Size()
+}
+
+func (u *usageTotals) print(rootPath string) {
+	if !*summarizeFlag {
+		var names []string
+		for name := range u.entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%7s  %s\n", humanizeBytes(u.entries[name]), name)
+		}
+	}
+	fmt.Printf("%7s  %s\n", humanizeBytes(u.total), rootPath)
+}
+
+func printTree(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get target path, making sure it stays inside the repository
+	targetPath, err := resolvePath(&repo, name)
+	if err != nil {
+		return usageError(err)
+	}
+
+	root := newTreeNode()
+
+	switch repo.Type {
+	case "local", "network":
+		err = filepath.Walk(targetPath, func(itemPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(targetPath, itemPath)
+			if err != nil || relPath == "." {
+				return err
+			}
+			if !root.add(filepath.ToSlash(relPath), info) && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return transferError(fmt.Errorf("cannot walk repository: %w", err))
+		}
+	case "ssh":
+		targetPath = filepath.ToSlash(targetPath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		walker := sftp.Walk(targetPath)
+		for walker.Step() {
+			if walker.Err() != nil {
+				return transferError(fmt.Errorf("cannot walk remote directory: %w", walker.Err()))
+			}
+			relPath := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), targetPath), "/")
+			if relPath == "" {
+				continue
+			}
+			if !root.add(relPath, walker.Stat()) && walker.Stat().IsDir() {
+				walker.SkipDir()
+			}
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'tree'", repo.Type))
+	}
+
+	if name == "" {
+		name = "."
+	}
+	fmt.Println(name)
+	dirs, files := root.print("")
+	if *dirsOnlyFlag {
+		fmt.Printf("\n%d directories\n", dirs)
+	} else {
+		fmt.Printf("\n%d directories, %d files\n", dirs, files)
+	}
+	return nil
+}
+
+// treeNode is a directory of the tree printed by 'tree', or a file when it
+// has no children map.
+type treeNode struct {
+	children map[string]*treeNode
+}
+
+func newTreeNode() *treeNode {
+	return &treeNode{children: map[string]*treeNode{}}
+}
+
+// add puts the entry at relPath, a slash path relative to the root of the
+// tree, below its parent. It returns false if the entry is left out by
+// --depth or --dirs-only.
+func (t *treeNode) add(relPath string, info os.FileInfo) bool {
+	if *depthFlag >= 0 && pathDepth(relPath) > *depthFlag {
+		return false
+	}
+	if *dirsOnlyFlag && !info.IsDir() {
+		return false
+	}
+
+	parts := strings.Split(relPath, "/")
+	node := t
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := node.children[part]
+		if !ok {
+			child = newTreeNode()
+			node.children[part] = child
+		}
+		node = child
+	}
+
+	entry := &treeNode{}
+	if info.IsDir() {
+		entry = newTreeNode()
+	}
+	node.children[parts[len(parts)-1]] = entry
+	return true
+}
+
+// print prints the children of t sorted by name, each line starting with
+// prefix, and returns how many directories and files it printed.
+func (t *treeNode) print(prefix string) (dirs, files int) {
+	var names []string
+	for name := range t.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		connector, indent := "├── ", "│   "
+		if i == len(names)-1 {
+			connector, indent = "└── ", "    "
+		}
+
+		child := t.children[name]
+		if child.children == nil {
+			fmt.Printf("%s%s%s\n", prefix, connector, name)
+			files++
+			continue
+		}
+
+		fmt.Printf("%s%s%s/\n", prefix, connector, name)
+		subDirs, subFiles := child.print(prefix + indent)
+		dirs += subDirs + 1
+		files += subFiles
+	}
+	return dirs, files
+}
+
+// findMatch tells whether info is of the --type asked for and its name
+// matches pattern, as a glob if it has wildcards or as a substring.
+func findMatch(info os.FileInfo, pattern string) bool {
+	if (*typeFlag == "f" && info.IsDir()) || (*typeFlag == "d" && !info.IsDir()) {
+		return false
+	}
+	if isGlob(pattern) {
+		matched, _ := path.Match(pattern, info.Name())
+		return matched
+	}
+	return strings.Contains(info.Name(), pattern)
+}
+
+// pathDepth returns the number of elements of a relative slash path.
+func pathDepth(relPath string) int {
+	return strings.Count(relPath, "/") + 1
+}
+
+// printStat prints the details of info as a key/value block.
+func printStat(targetPath string, info os.FileInfo) {
+	kind := "file"
+	if info.IsDir() {
+		kind = "directory"
+	}
+
+	printStatField("Name", info.Name())
+	printStatField("Path", targetPath)
+	printStatField("Type", kind)
+	printStatField("Size", fmt.Sprintf("%s (%d bytes)", humanizeBytes(info.Size()), info.Size()))
+	printStatField("Mode", fmt.Sprintf("%s (%04o)", info.Mode(), info.Mode().Perm()))
+	printStatField("Modified", info.ModTime().Format(time.RFC3339))
+}
+
+// printSFTPStat prints the owner and access time that SFTP reports on top
+// of the usual file information.
+func printSFTPStat(info os.FileInfo) {
+	stat, ok := info.Sys().(*sftp.FileStat)
+	if !ok {
+		return
+	}
+	printStatField("UID", fmt.Sprint(stat.UID))
+	printStatField("GID", fmt.Sprint(stat.GID))
+	printStatField("Accessed", time.Unix(int64(stat.Atime), 0).Format(time.RFC3339))
+}
+
+func printStatField(key, value string) {
+	fmt.Printf("%-9s %s\n", key+":", value)
+}
+
+func syncRepository(config *Config, localDir string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get local and remote paths
+	localPath, err := filepath.Abs(localDir)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot access path '%s': %w", localPath, err))
+	}
+	if !info.IsDir() {
+		return transferError(fmt.Errorf("'%s' is not a directory", localPath))
+	}
+	// The directory is synced to the one of the same name in the current
+	// directory of the repository, wherever it is locally
+	destPath, err := resolvePath(&repo, filepath.Base(localPath))
+	if err != nil {
+		return usageError(err)
+	}
+	destRelPath, err := filepath.Rel(repo.Path, destPath)
+	if err != nil {
+		return usageError(err)
+	}
+
+	var stats syncStats
+	switch repo.Type {
+	case "local", "network":
+		stats, err = syncTree(localPath, destRelPath,
+			func(relPath string) (os.FileInfo, error) {
+				return os.Stat(filepath.Join(destPath, relPath))
+			},
+			func(relPath string) error {
+				if *dryRunFlag {
+					fmt.Printf("Would create directory '%s'\n", filepath.Join(destPath, relPath))
+					return nil
+				}
+				return os.MkdirAll(filepath.Join(destPath, relPath), 0755)
+			},
+			func(localItemPath, relPath string) error {
+				return copy(localItemPath, filepath.Join(destPath, relPath))
+			})
+	case "ssh":
+		destPath = filepath.ToSlash(destPath)
+
+		// Get SSH client
+		var client *goph.Client
+		client, err = getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		var sftp *sftp.Client
+		sftp, err = client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		stats, err = syncTree(localPath, destRelPath,
+			func(relPath string) (os.FileInfo, error) {
+				return sftp.Stat(path.Join(destPath, filepath.ToSlash(relPath)))
+			},
+			func(relPath string) error {
+				if *dryRunFlag {
+					fmt.Printf("Would create directory '%s'\n", path.Join(destPath, filepath.ToSlash(relPath)))
+					return nil
+				}
+				return sftp.MkdirAll(path.Join(destPath, filepath.ToSlash(relPath)))
+			},
+			func(localItemPath, relPath string) error {
+				return uploadFile(sftp, localItemPath, path.Join(destPath, filepath.ToSlash(relPath)))
+			})
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'sync'", repo.Type))
+	}
+
+	if err != nil {
+		return transferError(fmt.Errorf("'sync' failed: %w", err))
+	}
+	infof("Sync complete: %d uploaded, %d skipped\n", stats.transferred, stats.skipped)
+
+	return nil
+}
+
+func pullRepository(config *Config, localDir string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get local path
+	localPath, err := filepath.Abs(localDir)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+	}
+	if _, err := os.Stat(localPath); os.IsNotExist(err) {
+		err = makeLocalDirectory(localPath)
+		if err != nil {
+			return transferError(err)
+		}
+	}
+
+	// Remember every repository entry to find the local extraneous ones
+	seen := map[string]bool{}
+	var stats syncStats
+
+	switch repo.Type {
+	case "local", "network":
+		err = filepath.Walk(repo.Path, func(srcItemPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fmt.Errorf("error walking repository: %v", err)
+			}
+
+			relPath, err := filepath.Rel(repo.Path, srcItemPath)
+			if err != nil {
+				return err
+			}
+			if relPath != "." && skipEntry(relPath, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			seen[relPath] = true
+			localItemPath := filepath.Join(localPath, relPath)
+
+			localInfo, err := os.Stat(localItemPath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			if info.IsDir() {
+				if localInfo == nil {
+					return makeLocalDirectory(localItemPath)
+				}
+				return nil
+			}
+
+			if skipFile(srcItemPath, info) || !needsSync(info, localInfo) {
+				stats.skipped++
+				return nil
+			}
+			stats.transferred++
+			return copy(srcItemPath, localItemPath)
+		})
+	case "ssh":
+		remotePath := filepath.ToSlash(repo.Path)
+
+		// Get SSH client
+		var client *goph.Client
+		client, err = getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		var sftp *sftp.Client
+		sftp, err = client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		// Walk remote directory, collecting the files to download
+		var jobs []transferJob
+		walker := sftp.Walk(remotePath)
+		for walker.Step() {
+			if walker.Err() != nil {
+				return transferError(fmt.Errorf("cannot walk remote directory: %w", walker.Err()))
+			}
+
+			if walker.Path() == remotePath {
+				continue
+			}
+			relPath := relativePath(remotePath, walker.Path())
+			if skipEntry(relPath, walker.Stat().IsDir()) {
+				if walker.Stat().IsDir() {
+					walker.SkipDir()
+				}
+				continue
+			}
+			seen[filepath.FromSlash(relPath)] = true
+			localItemPath := filepath.Join(localPath, filepath.FromSlash(relPath))
+
+			localInfo, err := os.Stat(localItemPath)
+			if err != nil && !os.IsNotExist(err) {
+				return transferError(fmt.Errorf("cannot get local file info: %w", err))
+			}
+
+			if walker.Stat().IsDir() {
+				if localInfo == nil {
+					err = makeLocalDirectory(localItemPath)
+					if err != nil {
+						return transferError(err)
+					}
+				}
+				continue
+			}
+
+			if skipFile(walker.Path(), walker.Stat()) || !needsSync(walker.Stat(), localInfo) {
+				stats.skipped++
+				continue
+			}
+			jobs = append(jobs, transferJob{remotePath: walker.Path(), localPath: localItemPath})
+		}
+
+		stats.transferred = len(jobs)
+		pool := newSFTPPool(client, sftp)
+		defer pool.Close()
+		err = downloadFiles(pool, jobs)
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'pull'", repo.Type))
+	}
+
+	if err != nil {
+		return transferError(fmt.Errorf("'pull' failed: %w", err))
+	}
+
+	// Remove local files that are gone from the repository
+	deleted := 0
+	if *deleteFlag {
+		deleted, err = deleteExtraneous(localPath, seen)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot delete local files: %w", err))
+		}
+	}
+
+	infof("Pull complete: %d downloaded, %d skipped, %d deleted\n", stats.transferred, stats.skipped, deleted)
+
+	return nil
+}
+
+// mirrorRepository makes a local directory and the current directory of the
+// repository hold the same files, copying each change to the other side and
+// reporting the files changed on both sides since the last mirror.
+func mirrorRepository(config *Config, localDir string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get local path
+	localPath, err := filepath.Abs(localDir)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+	}
+	if _, err := os.Stat(localPath); os.IsNotExist(err) {
+		err = makeLocalDirectory(localPath)
+		if err != nil {
+			return transferError(err)
+		}
+	}
+
+	// Get the state of both sides after the last mirror
+	baselines, err := loadMirrorBaselines()
+	if err != nil {
+		return configError(fmt.Errorf("cannot load mirror baselines: %w", err))
+	}
+	key := mirrorKey(config.Current, repo.Path, localPath)
+
+	var stats mirrorStats
+	var baseline mirrorBaseline
+	switch repo.Type {
+	case "local", "network":
+		repoPath := func(relPath string) string {
+			return filepath.Join(repo.Path, filepath.FromSlash(relPath))
+		}
+		stats, baseline, err = mirrorTree(localPath, baselines[key], mirrorRemote{
+			walk: func() (map[string]os.FileInfo, error) {
+				return walkLocalFiles(repo.Path)
+			},
+			stat: func(relPath string) (os.FileInfo, error) {
+				return os.Stat(repoPath(relPath))
+			},
+			open: func(relPath string) (io.ReadCloser, error) {
+				return os.Open(repoPath(relPath))
+			},
+			upload: func(localItemPath, relPath string) error {
+				if !*dryRunFlag {
+					err := os.MkdirAll(filepath.Dir(repoPath(relPath)), 0755)
+					if err != nil {
+						return err
+					}
+				}
+				return copy(localItemPath, repoPath(relPath))
+			},
+			download: func(relPath, localItemPath string) error {
+				err := makeParentDirectory(localItemPath)
+				if err != nil {
+					return err
+				}
+				return copy(repoPath(relPath), localItemPath)
+			},
+			remove: func(relPath string) error {
+				return os.Remove(repoPath(relPath))
+			},
+		})
+	case "ssh":
+		remotePath := filepath.ToSlash(repo.Path)
+
+		// Get SSH client
+		var client *goph.Client
+		client, err = getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		var sftp *sftp.Client
+		sftp, err = client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		stats, baseline, err = mirrorTree(localPath, baselines[key], mirrorRemote{
+			walk: func() (map[string]os.FileInfo, error) {
+				files := map[string]os.FileInfo{}
+				walker := sftp.Walk(remotePath)
+				for walker.Step() {
+					if walker.Err() != nil {
+						return nil, fmt.Errorf("error walking remote directory: %v", walker.Err())
+					}
+
+					if walker.Path() == remotePath {
+						continue
+					}
+					relPath := relativePath(remotePath, walker.Path())
+					if skipEntry(relPath, walker.Stat().IsDir()) {
+						if walker.Stat().IsDir() {
+							walker.SkipDir()
+						}
+						continue
+					}
+					if walker.Stat().Mode().IsRegular() {
+						files[relPath] = walker.Stat()
+					}
+				}
+				return files, nil
+			},
+			stat: func(relPath string) (os.FileInfo, error) {
+				return sftp.Stat(path.Join(remotePath, relPath))
+			},
+			open: func(relPath string) (io.ReadCloser, error) {
+				return sftp.Open(path.Join(remotePath, relPath))
+			},
+			upload: func(localItemPath, relPath string) error {
+				if !*dryRunFlag {
+					err := sftp.MkdirAll(path.Dir(path.Join(remotePath, relPath)))
+					if err != nil {
+						return fmt.Errorf("could not create remote directory: %v", err)
+					}
+				}
+				return uploadFile(sftp, localItemPath, path.Join(remotePath, relPath))
+			},
+			download: func(relPath, localItemPath string) error {
+				err := makeParentDirectory(localItemPath)
+				if err != nil {
+					return err
+				}
+				return downloadFile(sftp, path.Join(remotePath, relPath), localItemPath, true)
+			},
+			remove: func(relPath string) error {
+				return sftp.Remove(path.Join(remotePath, relPath))
+			},
+		})
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'mirror'", repo.Type))
+	}
+
+	if err != nil {
+		return transferError(fmt.Errorf("'mirror' failed: %w", err))
+	}
+
+	// Remember the state of both sides for the next mirror
+	if !*dryRunFlag {
+		baselines[key] = baseline
+		err = saveMirrorBaselines(baselines)
+		if err != nil {
+			return configError(fmt.Errorf("cannot save mirror baselines: %w", err))
+		}
+	}
+
+	infof("Mirror complete: %d uploaded, %d downloaded, %d deleted, %d conflicts\n",
+		stats.uploaded, stats.downloaded, stats.deleted, stats.conflicts)
+	if stats.conflicts > 0 {
+		return transferError(fmt.Errorf("%d files changed on both sides, keep one version and mirror again", stats.conflicts))
+	}
+
+	return nil
+}
+
+// cloneRepository downloads the whole current directory of the repository
+// into dest, which must be missing or empty, and reports how much was
+// transferred.
+func cloneRepository(config *Config, dest string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get local path, refusing to mix the repository with other files
+	localPath, err := filepath.Abs(dest)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+	}
+	entries, err := ioutil.ReadDir(localPath)
+	if err != nil && !os.IsNotExist(err) {
+		return transferError(fmt.Errorf("cannot read '%s': %w", localPath, err))
+	}
+	if len(entries) > 0 {
+		return usageError(fmt.Errorf("destination '%s' is not empty", localPath))
+	}
+
+	err = downloadRepository(&repo, localPath)
+	if err != nil {
+		// Connection errors are already told apart
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			return err
+		}
+		return transferError(fmt.Errorf("'clone' failed: %w", err))
+	}
+	if *dryRunFlag {
+		return nil
+	}
+
+	// The destination was empty, everything in it was transferred
+	files := 0
+	var size int64
+	err = filepath.Walk(localPath, func(itemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return transferError(fmt.Errorf("cannot walk '%s': %w", localPath, err))
+	}
+
+	infof("Clone complete: %d files, %s\n", files, humanizeBytes(size))
+	return nil
+}
+
+// downloadRepository downloads the current directory of repo into
+// localPath.
+func downloadRepository(repo *Repository, localPath string) error {
+	switch repo.Type {
+	case "local", "network":
+		// Shares that are not mounted are reached over SMB
+		if useSMB(repo) {
+			share, err := getSMBShare(repo)
+			if err != nil {
+				return connectionError(fmt.Errorf("cannot connect to SMB share: %w", err))
+			}
+			defer share.Close()
+
+			return downloadSMBDirectory(share, share.path(""), localPath)
+		}
+
+		return copy(repo.Path, localPath)
+	case "ssh":
+		// Get SSH client
+		client, err := getSSHClient(repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		pool := newSFTPPool(client, sftp)
+		defer pool.Close()
+		return downloadDirectory(pool, filepath.ToSlash(repo.Path), localPath, repo.Path)
+	case "s3":
+		// Get S3 client
+		client, err := getS3Client(repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create S3 client: %w", err))
+		}
+
+		err = makeLocalDirectory(localPath)
+		if err != nil {
+			return err
+		}
+		return downloadS3Directory(client, repo.Bucket, objectKey(repo.Path, ""), localPath)
+	case "gcs":
+		// Get GCS client
+		client, err := getGCSClient(repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create GCS client: %w", err))
+		}
+		defer client.Close()
+
+		err = makeLocalDirectory(localPath)
+		if err != nil {
+			return err
+		}
+		return downloadGCSDirectory(client, repo.Bucket, objectKey(repo.Path, ""), localPath)
+	case "ftp":
+		// Get FTP client
+		client, err := getFTPClient(repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to FTP server: %w", err))
+		}
+		defer client.Quit()
+
+		return downloadFTPDirectory(client, ftpPath(repo, ""), localPath)
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'clone'", repo.Type))
+	}
+}
+
+// deleteExtraneous removes the entries below localPath whose relative path
+// is not in seen, and returns how many were removed. Entries filtered out by
+// --include and --exclude are kept.
+func deleteExtraneous(localPath string, seen map[string]bool) (int, error) {
+	deleted := 0
+	err := filepath.Walk(localPath, func(localItemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(localPath, localItemPath)
+		if err != nil {
+			return err
+		}
+		if relPath == "." || seen[relPath] {
+			return nil
+		}
+		if skipEntry(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		deleted++
+		if *dryRunFlag {
+			fmt.Printf("Would delete '%s'\n", localItemPath)
+		} else {
+			err = os.RemoveAll(localItemPath)
+			if err != nil {
+				return err
+			}
+			infof("Deleted '%s'\n", localItemPath)
+		}
+
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+// syncStats counts the files handled by a sync.
+type syncStats struct {
+	transferred int
+	skipped     int
+}
+
+// syncTree walks a local directory and uploads the files that are missing or
+// changed on the repository side. Repository entries are looked up, created
+// and written through the given functions, using paths relative to localPath.
+// Entries are filtered by --include and --exclude with their path relative to
+// the repository directory, destRelPath being the one of localPath, and
+// files by --since, --min-size and --max-size.
+func syncTree(localPath, destRelPath string,
+	statRemote func(relPath string) (os.FileInfo, error),
+	makeRemoteDir func(relPath string) error,
+	upload func(localItemPath, relPath string) error) (syncStats, error) {
+
+	var stats syncStats
+	err := filepath.Walk(localPath, func(localItemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking local directory: %v", err)
+		}
+
+		relPath, err := filepath.Rel(localPath, localItemPath)
+		if err != nil {
+			return err
+		}
+
+		if relPath != "." && skipEntry(filepath.Join(destRelPath, relPath), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			logf(logVerbose, "Walking '%s'\n", localItemPath)
+		}
+
+		remoteInfo, err := statRemote(relPath)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("could not get info for '%s': %v", relPath, err)
+		}
+
+		if info.IsDir() {
+			if remoteInfo == nil {
+				return makeRemoteDir(relPath)
+			}
+			return nil
+		}
+
+		if skipFile(localItemPath, info) || !needsSync(info, remoteInfo) {
+			stats.skipped++
+			return nil
+		}
+
+		err = upload(localItemPath, relPath)
+		if err != nil {
+			return err
+		}
+		stats.transferred++
+		return nil
+	})
+
+	return stats, err
+}
+
+// needsSync tells whether a source file must be transferred over its
+// destination, i.e. when the destination is missing, of a different size or
+// older. Times are compared to the second as not all servers keep more.
+func needsSync(srcInfo, destInfo os.FileInfo) bool {
+	if destInfo == nil {
+		return true
+	}
+	return destInfo.Size() != srcInfo.Size() ||
+		destInfo.ModTime().Before(srcInfo.ModTime().Truncate(time.Second))
+}
+
+// resolvePath joins name to the repository path and makes sure the result
+// does not escape it (e.g. through "..").
+func resolvePath(repo *Repository, name string) (string, error) {
+	fullPath := filepath.Join(repo.Path, name)
+	relPath, err := filepath.Rel(filepath.Clean(repo.Path), fullPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("'%s' is outside of the repository path '%s'", name, repo.Path)
+	}
+	return fullPath, nil
+}
+
+// unchangedCopy tells whether dest already holds src, being of the same size
+// and modification time, or of the same contents with --checksum.
+func unchangedCopy(src, dest string, srcInfo os.FileInfo) bool {
+	destInfo, err := os.Lstat(dest)
+	if err != nil || !destInfo.Mode().IsRegular() || destInfo.Size() != srcInfo.Size() {
+		return false
+	}
+	if !*checksumFlag {
+		return destInfo.ModTime().Truncate(time.Second).Equal(srcInfo.ModTime().Truncate(time.Second))
+	}
+
+	srcSum, err := fileSum(src)
+	if err != nil {
+		return false
+	}
+	destSum, err := fileSum(dest)
+	return err == nil && srcSum == destSum
+}
+
+// copy copies the file or folder src to dest. Symbolic links are copied as
+// links, or replaced by what they point to with --follow-symlinks. The files
+// of a folder are filtered by --since, --min-size and --max-size.
+func copy(src, dest string) error {
+	return copyTree(src, dest, nil)
+}
+
+// copyTree copies src to dest, ancestors being the folders copied above src
+// to detect symbolic link loops.
+func copyTree(src, dest string, ancestors []os.FileInfo) error {
+	// Get source info
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if srcInfo.Mode()&os.ModeSymlink != 0 {
+		if !*followFlag {
+			return copyLink(src, dest)
+		}
+		srcInfo, err = os.Stat(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping broken symbolic link '%s'\n", src)
+			return nil
+		}
+	}
+
+	// Check if source is a directory
+	if srcInfo.IsDir() {
+		for _, ancestor := range ancestors {
+			if os.SameFile(ancestor, srcInfo) {
+				fmt.Fprintf(os.Stderr, "Warning: skipping '%s', symbolic link loop\n", src)
+				return nil
+			}
+		}
+		ancestors = append(ancestors, srcInfo)
+
+		// Create destination directory
+		if *dryRunFlag {
+			fmt.Printf("Would create directory '%s'\n", dest)
+		} else {
+			err = os.MkdirAll(dest, srcInfo.Mode())
+			if err != nil {
+				return err
+			}
+		}
+
+		// Get directory contents
+		logf(logVerbose, "Walking '%s'\n", src)
+		files, err := ioutil.ReadDir(src)
+		if err != nil {
+			return err
+		}
+
+		// Copy directory contents
+		for _, file := range files {
+			srcPath := filepath.Join(src, file.Name())
+			destPath := filepath.Join(dest, file.Name())
+			err = copyTree(srcPath, destPath, ancestors)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Once filled, as adding entries changes the modification time
+		if !*dryRunFlag {
+			return preserveLocal(dest, srcInfo)
+		}
+	} else if len(ancestors) > 0 && skipFile(src, srcInfo) {
+		return nil
+	} else if (*updateFlag || *checksumFlag) && unchangedCopy(src, dest, srcInfo) {
+		logf(logVerbose, "Skipping '%s', unchanged\n", src)
+	} else if *dryRunFlag {
+		fmt.Printf("Would copy '%s' to '%s'\n", src, dest)
+	} else {
+		logf(logVerbose, "Copying '%s' to '%s'\n", src, dest)
+
+		// Open source file
+		srcFile, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer srcFile.Close()
+
+		// Copy file contents
+		err = writeLocalFile(dest, srcFile, srcInfo)
+		if err != nil {
+			return err
+		}
+		transferredBytes.Add(srcInfo.Size())
+	}
+
+	return nil
+}
+
+// copyLink recreates the symbolic link src at dest, with the same target.
+func copyLink(src, dest string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if *dryRunFlag {
+		fmt.Printf("Would link '%s' to '%s'\n", dest, target)
+		return nil
+	}
+
+	logf(logVerbose, "Linking '%s' to '%s'\n", dest, target)
+	return makeLocalLink(target, dest)
+}
+
+// makeLocalLink creates a symbolic link to target at localPath, replacing
+// the file or link found there.
+func makeLocalLink(target, localPath string) error {
+	info, err := os.Lstat(localPath)
+	if err == nil && !info.IsDir() {
+		err = os.Remove(localPath)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Symlink(target, localPath)
+}
+
+func printUsage() {
+	fmt.Printf("0s %s.%s-%s - https://github.com/jplozf/0s\n", majorVersion, minorVersion, gitCommit)
+	if configFilePath != "" {
+		fmt.Printf("Configuration file can be found at %s\n", configFilePath)
+	}
+	fmt.Println("")
+	fmt.Println("Usage: 0s [options] <command>")
+	fmt.Println("Commands:")
+	fmt.Println("  list           - List all available repositories (alias: repos)")
+	fmt.Println("  set <repo>     - Set the current repository")
+	fmt.Println("  add <name> <type> [path|host]")
+	fmt.Println("                 - Add a repository (local, network, ssh or ftp), a network path may be a")
+	fmt.Println("                   \\\\host\\share UNC path, reached over SMB with --user, --password and")
+	fmt.Println("                   --domain when it is not accessible")
+	fmt.Println("  remove <repo>  - Remove a repository from the configuration (alias: del-repo)")
+	fmt.Println("  rename-repo <old> <new>")
+	fmt.Println("                 - Rename a repository of the configuration")
+	fmt.Println("  copy-repo <src> <dst>")
+	fmt.Println("                 - Add a copy of a repository, changing the settings given by --path, --host,")
+	fmt.Println("                   --port, --user, --key, --password, --ssh-host, --share, --domain")
+	fmt.Println("                   or --root")
+	fmt.Println("  export <file>  - Write the configuration to file, or stdout with -, without secrets with")
+	fmt.Println("                   --no-secrets")
+	fmt.Println("  import <file>  - Add the repositories of another configuration, replacing those of the same")
+	fmt.Println("                   name with --overwrite")
+	fmt.Println("  config get <repo> <field>")
+	fmt.Println("                 - Print a setting of a repository, named as in the configuration file, or")
+	fmt.Println("                   jump.<field> for its jump host, passwords and keys only with --show-secrets")
+	fmt.Println("  config set <repo> <field> <value>")
+	fmt.Println("                 - Change a setting of a repository and save the configuration")
+	fmt.Println("  show           - Show files in the current repository, and those of its subdirectories with -R")
+	fmt.Println("  pwd            - Print the current directory of the repository")
+	fmt.Println("  whoami         - Show the user, host and authentication the repository is reached with,")
+	fmt.Println("                   and the account id reports on SSH servers")
+	fmt.Println("  cd <dir>       - Change the current directory for the repository, from its root if dir is")
+	fmt.Println("                   absolute, or back to the previous one with -, never above the root set")
+	fmt.Println("                   with --root")
+	fmt.Println("  get <name>     - Get a file or folder from the current repository")
+	fmt.Println("  put <name>     - Put a file or folder in the current repository")
+	fmt.Println("  broadcast <name> <repo1,repo2,...>")
+	fmt.Println("                 - Put a file or folder in several repositories at once")
+	fmt.Println("  transfer <repo>:<path> <repo>:<path>")
+	fmt.Println("                 - Copy a file or folder from an SSH repository to another, without storing it")
+	fmt.Println("                   locally")
+	fmt.Println("  rm <name>      - Remove a file or folder from the current repository")
+	fmt.Println("  mv <src> <dst> - Rename or move a file or folder within the current repository")
+	fmt.Println("  touch <name>   - Create an empty file or set its modification time to now")
+	fmt.Println("  cat <name>     - Print a file from the current repository to stdout")
+	fmt.Println("  head <name>    - Print the first lines of a file from the current repository (see -n)")
+	fmt.Println("  tail <name>    - Print the last lines of a file from the current repository (see -n)")
+	fmt.Println("  diff <name>    - Compare a local file, where 'get' would write it, with its version in the")
+	fmt.Println("                   current repository")
+	fmt.Println("  edit <name>    - Edit a file of the current repository with $EDITOR")
+	fmt.Println("  open <name>    - Open a file of the current repository with the default application")
+	fmt.Println("  stat <name>    - Show detailed information about a file or folder (alias: info)")
+	fmt.Println("  find <pattern> - Find files and folders whose name matches a pattern or contains a string")
+	fmt.Println("  grep <pattern> [path]")
+	fmt.Println("                 - Print the lines of the files matching a regular expression, as path:line:text")
+	fmt.Println("  du [path]      - Show the size of the repository or of a path, per top-level entry")
+	fmt.Println("  tree [path]    - Show the repository or a path as a tree of folders and files")
+	fmt.Println("  sync <dir>     - Upload the files of a local directory that are missing or changed, to the")
+	fmt.Println("                   folder of the same name in the current directory of the repository")
+	fmt.Println("  pull <dir>     - Download the repository files that are missing or changed into a local directory")
+	fmt.Println("  mirror <dir>   - Copy the changes of a local directory and of the repository both ways,")
+	fmt.Println("                   reporting the files changed on both sides since the last mirror")
+	fmt.Println("  clone <dir>    - Download the whole repository into a new or empty local directory")
+	fmt.Println("  check          - Validate the configuration and try to reach every repository")
+	fmt.Println("  ping [repo]    - Tell whether a repository, the current one by default or all with --all,")
+	fmt.Println("                   can be reached and how long it takes")
+	fmt.Println("  history [n]    - Show the last n (default 10) get, put and rm, or forget them with --clear")
+	fmt.Println("  interactive    - Run commands typed at a prompt, keeping SSH connections open between them")
+	fmt.Println("  completion <shell>")
+	fmt.Println("                 - Print the completion script for bash or zsh")
+	fmt.Println("Options:")
+	fmt.Println("  --config <file> - Use this configuration file (default: $ZEROS_CONFIG, then .0s/config.json")
+	fmt.Println("                    in the current directory or above, then $XDG_CONFIG_HOME/0s/config.json,")
+	fmt.Println("                    then ~/.0s/config.json)")
+	fmt.Println("  --host, --port, --user, --key, --password, --path, --ssh-host, --share, --domain,")
+	fmt.Println("  --root")
+	fmt.Println("                  - Repository settings for 'add', the password may be read from a file")
+	fmt.Println("                    with file:<path> or printed by a command with cmd:<command>")
+	fmt.Println("  --repo <repo>   - Work on repo instead of the current repository, without making it current")
+	fmt.Println("  --force         - Replace an existing repository with 'add', do not ask before 'rm -r'")
+	fmt.Println("  -q, --quiet     - Do not report transfer progress nor the files transferred")
+	fmt.Println("  -v, --verbose   - Report connections, walked folders and each transfer on stderr")
+	fmt.Println("  --dry-run       - Show what 'get', 'put' and 'rm' would do without doing it")
+	fmt.Println("  --verify        - Check SHA-256 checksums after SSH downloads and uploads, the size of")
+	fmt.Println("                    uploads being always checked")
+	fmt.Println("  --parallel <n>  - Download up to n files at once over SSH (default 4)")
+	fmt.Println("  --sessions <n>  - Share the parallel SSH downloads among up to n SFTP sessions of the connection")
+	fmt.Println("                    (default 2), fewer if the server allows fewer")
+	fmt.Println("  --delete        - Delete local files missing from the repository with 'pull', and with 'mirror'")
+	fmt.Println("                    the files deleted on one side from the other")
+	fmt.Println("  --resume        - Continue partial SSH downloads instead of starting over")
+	fmt.Println("  -r, -R, --recursive")
+	fmt.Println("                  - Allow 'rm' to remove a directory and its contents, list them with 'show'")
+	fmt.Println("  --type f|d      - Only find files (f) or directories (d)")
+	fmt.Println("  --maxdepth <n>  - Descend at most n levels below the current directory with 'find'")
+	fmt.Println("  -i, --ignore-case")
+	fmt.Println("                  - Match without regard to case with 'grep'")
+	fmt.Println("  --summarize     - Only print the total size with 'du'")
+	fmt.Println("  --depth <n>     - Descend at most n levels with 'tree'")
+	fmt.Println("  --dirs-only     - Only show folders with 'tree'")
+	fmt.Println("  -n <lines>      - Number of lines printed by 'head' and 'tail' (default: 10)")
+	fmt.Println("  -f              - Keep printing the data appended to the file with 'tail', until interrupted")
+	fmt.Println("  --no-perms      - Do not preserve permissions and modification times on transfers")
+	fmt.Println("  --create-dirs=false")
+	fmt.Println("                  - Fail to 'put' to local and SSH repositories where the parent directories")
+	fmt.Println("                    of the destination are missing, instead of creating them")
+	fmt.Println("  --stdin         - Put what is piped on stdin as the given name, for local and SSH repositories")
+	fmt.Println("  --stdout        - Write the file given to 'get' to stdout, as is, instead of the download directory")
+	fmt.Println("  --out <dir>     - Download with 'get' into dir instead of the repository download_dir")
+	fmt.Println("                    or the current directory")
+	fmt.Println("  --gzip          - Compress SSH transfers of single files through gzip on the server, worth it")
+	fmt.Println("                    for text over slow links, not for already compressed data")
+	fmt.Println("  --follow, --follow-symlinks")
+	fmt.Println("                  - Copy what symbolic links point to instead of the links, with local")
+	fmt.Println("                    repositories and SSH downloads, including a link given to 'get' itself")
+	fmt.Println("  --sort name|size|time")
+	fmt.Println("                  - Order the files of 'show' by name, folders first (default), or the largest")
+	fmt.Println("                    or most recent first")
+	fmt.Println("  --reverse       - Reverse the order of 'show'")
+	fmt.Println("  --json          - Print the repositories of 'list' as JSON, without secrets")
+	fmt.Println("  --output text|json")
+	fmt.Println("                  - Report each file transferred by SSH, FTP or the cloud as a line of text")
+	fmt.Println("                    (default) or as a JSON object on stdout, messages going to stderr")
+	fmt.Println("  --include <glob>, --exclude <glob>")
+	fmt.Println("                  - Only transfer the files matching glob, or leave out the entries matching it,")
+	fmt.Println("                    in directory transfers, 'sync' and 'pull' (repeatable, excludes win)")
+	fmt.Println("  --since <time>, --newer-than <time>")
+	fmt.Println("                  - Only get, put, sync, pull or find the files modified since a duration ago,")
+	fmt.Println("                    e.g. 24h or 7d, or since a date, e.g. 2025-01-01 or '2025-01-01 12:00'")
+	fmt.Println("  --update        - Do not copy the files of local and network repositories that are already")
+	fmt.Println("                    at the destination with the same size and modification time")
+	fmt.Println("  --checksum      - Like --update, comparing the contents of the files instead of their times")
+	fmt.Println("  --clear         - Empty the history with 'history'")
+	fmt.Println("  --all           - Ping every repository with 'ping'")
+	fmt.Println("  --no-secrets    - Leave passwords, passphrases and cloud keys out with 'export'")
+	fmt.Println("  --show-secrets  - Print passwords, passphrases and cloud keys with 'config get'")
+	fmt.Println("  --overwrite     - Replace the repositories of the same name with 'import'")
+	fmt.Println("  --min-size <size>, --max-size <size>")
+	fmt.Println("                  - Only get, put, sync, pull or find the files of at least or at most size,")
+	fmt.Println("                    e.g. 10K or 100M")
+	fmt.Println("  --exclude-from <file>")
+	fmt.Println("                  - Exclude the patterns of file, written as in a .gitignore (e.g. .0signore)")
+	fmt.Println("  --retries <n>   - Retry SSH connections and transfers n times on network errors (default 3)")
+	fmt.Println("  --limit <rate>  - Cap the transfer rate in bytes per second, e.g. 512K or 2M (not for S3 uploads)")
+	fmt.Println("  --deadline <duration>")
+	fmt.Println("                  - Abort the command if still running after duration, e.g. 90s or 5m, as Ctrl-C")
+	fmt.Println("                    does, leaving no partial file behind")
+	fmt.Println("Environment:")
+	fmt.Println("  ZEROS_CONFIG    - Path to the configuration file")
+	fmt.Println("  ZEROS_KEY       - Master key encrypting the passwords stored in the configuration")
+	fmt.Println("  EDITOR          - Editor used by 'edit' (default: vi, notepad on Windows)")
+	fmt.Println("Exit codes:")
+	fmt.Println("  0               - Success")
+	fmt.Println("  1               - Usage error (missing or invalid arguments)")
+	fmt.Println("  2               - Configuration error (unreadable file, unknown repository)")
+	fmt.Println("  3               - Connection error (SSH, SFTP, FTP, S3, GCS or Azure)")
+	fmt.Println("  4               - File not found or transfer error")
+	fmt.Println("  130             - Interrupted by Ctrl-C or SIGTERM, partial files being removed")
+}
+
+// resolveSSHRepository returns the settings an SSH connection to repo uses:
+// its own, with the gaps filled from ~/.ssh/config and the default port.
+func resolveSSHRepository(repo *Repository) (Repository, error) {
+	// Explicit settings win over ~/.ssh/config
+	resolved := *repo
+	normalizeHost(&resolved)
+	err := applySSHConfig(&resolved)
+	if err != nil {
+		return resolved, fmt.Errorf("cannot read ~/.ssh/config: %w", err)
+	}
+	if resolved.Port == 0 {
+		resolved.Port = 22
+	}
+	return resolved, nil
+}
+
+func getSSHClient(repo *Repository) (*goph.Client, error) {
+	// Reuse the connection of an interactive session
+	if shared, ok := sharedSSHClients[repo.Name]; ok && repo.Name != "" {
+		return borrowSSHClient(shared), nil
+	}
+
+	resolved, err := resolveSSHRepository(repo)
+	if err != nil {
+		return nil, err
+	}
+	resolved.Password, err = resolvePassword(resolved.Password)
+	if err != nil {
+		return nil, err
+	}
+	repo = &resolved
+
+	var auth goph.Auth
+
+	// The connection to the ssh-agent is only needed to authenticate
+	var agentConn net.Conn
+	defer func() {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+	}()
+
+	// Use the agent if asked to or if no credentials are configured,
+	// then password auth if provided, otherwise use public key auth.
+	switch {
+	case repo.UseAgent || (repo.Password == "" && repo.PrivateKey == ""):
+		auth, agentConn, err = getAgentAuth()
+		// Keyboard-interactive may do on its own without an agent
+		if err != nil && repo.KeyboardInteractive && !repo.UseAgent {
+			auth, err = nil, nil
+		}
+	case repo.Password != "":
+		auth = goph.Password(repo.Password)
+	default:
+		auth, agentConn, err = getKeyAuth(repo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if repo.KeyboardInteractive {
+		auth = append(auth, ssh.KeyboardInteractive(keyboardChallenge(repo)))
+	}
+
+	// Verify the host key against the pinned fingerprint or known_hosts,
+	// unless told otherwise
+	callback, err := getHostKeyCallback(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := 10 * time.Second
+	if repo.Timeout > 0 {
+		timeout = time.Duration(repo.Timeout) * time.Second
+	}
+
+	// Reach the server through the jump host or the proxy, if any
+	var dial func(network, addr string) (net.Conn, error)
+	var jumpClient *goph.Client
+	switch {
+	case repo.Jump != nil:
+		jump := *repo.Jump
+		jump.Type = "ssh"
+		jumpClient, err = getSSHClient(&jump)
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to jump host '%s': %w", jump.Host, err)
+		}
+		logf(logVerbose, "Going through jump host '%s'\n", jump.Host)
+		dial = func(network, addr string) (net.Conn, error) {
+			conn, err := jumpClient.Dial(network, addr)
+			if err != nil {
+				return nil, fmt.Errorf("cannot connect through jump host '%s': %w", jump.Host, err)
+			}
+			return conn, nil
+		}
+	case repo.Proxy != "":
+		dialer, err := getProxyDialer(repo.Proxy, timeout)
+		if err != nil {
+			return nil, err
+		}
+		logf(logVerbose, "Going through proxy '%s'\n", redactProxy(repo.Proxy))
+		dial = func(network, addr string) (net.Conn, error) {
+			conn, err := dialer.Dial(network, addr)
+			if err != nil {
+				return nil, fmt.Errorf("cannot connect through proxy '%s': %w", redactProxy(repo.Proxy), err)
+			}
+			return conn, nil
+		}
+	}
+
+	// Create new SSH client, trying again if the network fails
+	logf(logVerbose, "Connecting to '%s' port %d as '%s' with %s\n", repo.Host, repo.Port, repo.User, describeAuth(repo))
+	var client *goph.Client
+	err = retry(fmt.Sprintf("Connection to '%s'", repo.Host), func() error {
+		var err error
+		client, err = newSSHConn(&goph.Config{
+			User:     repo.User,
+			Addr:     repo.Host,
+			Port:     repo.Port,
+			Auth:     auth,
+			Timeout:  timeout,
+			Callback: callback,
+		}, dial)
+		return err
+	})
+	if err != nil && jumpClient != nil {
+		jumpClient.Close()
+	}
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return nil, fmt.Errorf("connection to '%s' timed out after %s", repo.Host, timeout)
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return nil, fmt.Errorf("connection to '%s' refused", repo.Host)
+		case strings.Contains(err.Error(), "unable to authenticate"):
+			return nil, fmt.Errorf("authentication as '%s' failed, tried %s: %w", repo.User, describeAuth(repo), err)
+		}
+		return nil, err
+	}
+
+	logf(logVerbose, "Connected to '%s' (%s)\n", repo.Host, client.Client.ServerVersion())
+	if sharedSSHClients != nil && repo.Name != "" {
+		sharedSSHClients[repo.Name] = client
+		client = borrowSSHClient(client)
+	}
+
+	// The jump host connection ends with the one it carries
+	if jumpClient != nil {
+		go func() {
+			client.Client.Wait()
+			jumpClient.Close()
+		}()
+	}
+
+	// Keep long idle sessions (e.g. big directory walks) from being dropped
+	go keepAlive(client.Client, 30*time.Second)
+
+	// Unblock the transfers stalled on the connection when the command is
+	// stopped, the shared ones being closed by their session
+	if sharedSSHClients == nil {
+		closeWhenStopped(client)
+	}
+
+	return client, nil
+}
+
+// applySSHConfig fills the host, port, user and private key of repo that are
+// not set with the ones of its SSHHost entry in ~/.ssh/config.
+func applySSHConfig(repo *Repository) error {
+	if repo.SSHHost == "" {
+		return nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	// Parse ~/.ssh/config, without it the alias is the host name
+	file, err := os.Open(filepath.Join(homeDir, ".ssh", "config"))
+	if os.IsNotExist(err) {
+		if repo.Host == "" {
+			repo.Host = repo.SSHHost
+		}
+		if repo.Port == 0 {
+			repo.Port = 22
+		}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	sshConfig, err := ssh_config.Decode(file)
+	if err != nil {
+		return err
+	}
+	get := func(key string) string {
+		value, _ := sshConfig.Get(repo.SSHHost, key)
+		return value
+	}
+
+	if repo.Host == "" {
+		repo.Host = strings.ReplaceAll(get("HostName"), "%h", repo.SSHHost)
+		if repo.Host == "" {
+			repo.Host = repo.SSHHost
+		}
+	}
+	if repo.Port == 0 {
+		port, err := strconv.ParseUint(get("Port"), 10, 16)
+		if err != nil {
+			port = 22
+		}
+		repo.Port = uint(port)
+	}
+	if repo.User == "" {
+		repo.User = get("User")
+	}
+	if repo.PrivateKey == "" {
+		repo.PrivateKey = expandHome(get("IdentityFile"), homeDir)
+	}
+
+	return nil
+}
+
+// expandHome replaces a leading "~" of filePath with homeDir.
+func expandHome(filePath, homeDir string) string {
+	if filePath == "~" {
+		return homeDir
+	}
+	if strings.HasPrefix(filePath, "~/") {
+		return filepath.Join(homeDir, filePath[2:])
+	}
+	return filePath
+}
+
+// keepAlive pings the server every interval until the connection is closed.
+func keepAlive(client *ssh.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func getAgentAuth() (goph.Auth, net.Conn, error) {
+	if !goph.HasAgent() {
+		return nil, nil, fmt.Errorf("ssh-agent is not running (SSH_AUTH_SOCK is not set)")
+	}
+
+	conn, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not reach ssh-agent at '%s', is it running? (%v)", os.Getenv("SSH_AUTH_SOCK"), err)
+	}
+
+	return goph.Auth{ssh.PublicKeysCallback(agent.NewClient(conn).Signers)}, conn, nil
+}
+
+// getKeyAuth offers the private keys of repo in order, then the keys of the
+// ssh-agent if one is running. Keys that cannot be loaded are skipped with a
+// warning as long as something else remains to try. The connection to the
+// agent is returned for the caller to close once authenticated.
+func getKeyAuth(repo *Repository) (goph.Auth, net.Conn, error) {
+	var signers []ssh.Signer
+	var failures []string
+	for _, keyFile := range privateKeys(repo) {
+		signer, err := getSigner(repo, keyFile)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("key '%s': %v", keyFile, err))
+			continue
+		}
+		signers = append(signers, signer)
+	}
+
+	var agentClient agent.ExtendedAgent
+	var conn net.Conn
+	if goph.HasAgent() {
+		var err error
+		conn, err = net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("ssh-agent: %v", err))
+		} else {
+			agentClient = agent.NewClient(conn)
+		}
+	}
+
+	if len(signers) == 0 && agentClient == nil {
+		return nil, nil, fmt.Errorf("no usable private key (%s)", strings.Join(failures, "; "))
+	}
+	for _, failure := range failures {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s\n", failure)
+	}
+
+	// A single public key method, as the SSH client only tries the first
+	// one of each kind
+	return goph.Auth{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			if agentClient == nil {
+				return signers, nil
+			}
+			agentSigners, err := agentClient.Signers()
+			if err != nil {
+				return signers, nil
+			}
+			return append(signers[:len(signers):len(signers)], agentSigners...), nil
+		}),
+	}, conn, nil
+}
+
+// getSigner loads a private key of repo, asking for its passphrase if it is
+// encrypted and the configured one is missing.
+func getSigner(repo *Repository, keyFile string) (ssh.Signer, error) {
+	signer, err := goph.GetSigner(keyFile, repo.Passphrase)
+
+	var missingErr *ssh.PassphraseMissingError
+	if errors.As(err, &missingErr) {
+		prompt := fmt.Sprintf("Passphrase for key '%s' of repository '%s': ", keyFile, repo.Name)
+		passphrase, err := readPassword(prompt)
+		if err != nil {
+			return nil, err
+		}
+		return goph.GetSigner(keyFile, passphrase)
+	}
+
+	return signer, err
+}
+
+// privateKeys returns the private key files of repo, given as a comma
+// separated list.
+func privateKeys(repo *Repository) []string {
+	var keys []string
+	for _, key := range strings.Split(repo.PrivateKey, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// keyboardChallenge answers the keyboard-interactive challenges of the
+// server for repo by asking each question on the terminal, echoing the
+// answer only if the server says so.
+func keyboardChallenge(repo *Repository) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		if len(questions) > 0 && !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("cannot answer keyboard-interactive challenge: stdin is not a terminal")
+		}
+		if name != "" {
+			fmt.Fprintln(os.Stderr, name)
+		}
+		if instruction != "" {
+			fmt.Fprintln(os.Stderr, instruction)
+		}
+
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			prompt := fmt.Sprintf("[%s] %s", repo.Name, question)
+			if !echos[i] {
+				answer, err := readPassword(prompt)
+				if err != nil {
+					return nil, err
+				}
+				answers[i] = answer
+				continue
+			}
+			fmt.Fprint(os.Stderr, prompt)
+			answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = strings.TrimRight(answer, "\r\n")
+		}
+		return answers, nil
+	}
+}
+
+// describeAuth tells which authentication methods are tried for repo, for
+// error messages.
+func describeAuth(repo *Repository) string {
+	var methods []string
+	switch {
+	case repo.UseAgent || (repo.Password == "" && repo.PrivateKey == ""):
+		methods = append(methods, "the ssh-agent")
+	case repo.Password != "":
+		methods = append(methods, "password")
+	default:
+		for _, key := range privateKeys(repo) {
+			methods = append(methods, fmt.Sprintf("key '%s'", key))
+		}
+		if goph.HasAgent() {
+			methods = append(methods, "the ssh-agent")
+		}
+	}
+	if repo.KeyboardInteractive {
+		methods = append(methods, "keyboard-interactive")
+	}
+	return strings.Join(methods, ", ")
+}
+
+// readPassword prompts on the terminal and reads a line with echo disabled.
+func readPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("cannot prompt for passphrase: stdin is not a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	return string(password), nil
+}
+
+func getHostKeyCallback(repo *Repository) (ssh.HostKeyCallback, error) {
+	// A pinned key is trusted alone, known_hosts is not looked at
+	if repo.HostKeyFingerprint != "" {
+		pinned := normalizeFingerprint(repo.HostKeyFingerprint)
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fingerprint := ssh.FingerprintSHA256(key)
+			if fingerprint != pinned {
+				return fmt.Errorf("host key mismatch for '%s': got %s key %s, expected %s", hostname, key.Type(), fingerprint, pinned)
+			}
+			return nil
+		}, nil
+	}
+
+	if repo.InsecureSkipVerify {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	callback, err := goph.DefaultKnownHosts()
+	if err != nil {
+		return nil, fmt.Errorf("could not load known_hosts (set \"insecure_skip_verify\" to bypass): %v", err)
+	}
+
+	// Wrap the callback so the user knows which key was rejected
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) && len(keyErr.Want) == 0 {
+			return fmt.Errorf("host '%s' is not in known_hosts (%s key %s)", hostname, key.Type(), fingerprint)
+		}
+		return fmt.Errorf("host key verification failed for '%s' (%s key %s): %v", hostname, key.Type(), fingerprint, err)
+	}, nil
+}
+
+// normalizeFingerprint returns fingerprint in the form of
+// ssh.FingerprintSHA256, accepting it without the SHA256: prefix or with
+// base64 padding.
+func normalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.TrimSuffix(strings.TrimSpace(fingerprint), "=")
+	return "SHA256:" + strings.TrimPrefix(fingerprint, "SHA256:")
+}
+
+// downloadFile downloads remotePath to localPath, trying again on transient
+// errors. Progress is reported on the terminal when showProgress is set,
+// unless --quiet was given.
+func downloadFile(sftp *sftp.Client, remotePath, localPath string, showProgress bool) error {
+	report := startTransfer("download", remotePath, localPath)
+	err := retry(fmt.Sprintf("Download of '%s'", remotePath), func() error {
+		return tryDownloadFile(sftp, remotePath, localPath, showProgress, report)
+	})
+	report.fail(err)
+	return err
+}
+
+func tryDownloadFile(sftp *sftp.Client, remotePath, localPath string, showProgress bool, report *transferReport) error {
+	if *dryRunFlag {
+		fmt.Printf("Would download '%s' to '%s'\n", remotePath, localPath)
+		return nil
+	}
+
+	logf(logVerbose, "Downloading '%s' to '%s'\n", remotePath, localPath)
+
+	// Open remote file
+	remoteFile, err := sftp.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("could not open remote file: %w", err)
+	}
+	defer remoteFile.Close()
+
+	remoteStat, err := remoteFile.Stat()
+	if err != nil {
+		return fmt.Errorf("could not get remote file info: %v", err)
+	}
+
+	// Write to a temporary file renamed into place once complete, it is
+	// only kept on failure to be resumed later
+	tmpPath := tempPath(localPath)
+	complete := false
+	defer func() {
+		if !complete && !*resumeFlag {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	// Append to a partial local file if asked to, otherwise start over
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if *resumeFlag {
+		// Pick up a partial file left by another tool as well, but not
+		// a larger one, that would be lost under the temporary name
+		if _, err := os.Stat(tmpPath); os.IsNotExist(err) {
+			info, err := os.Stat(localPath)
+			if err == nil && info.Mode().IsRegular() && info.Size() <= remoteStat.Size() {
+				os.Rename(localPath, tmpPath)
+			}
+		}
+		localStat, err := os.Stat(tmpPath)
+		if err == nil && localStat.Mode().IsRegular() {
+			if localStat.Size() > remoteStat.Size() {
+				return fmt.Errorf("cannot resume '%s', local file is larger than the remote one", localPath)
+			}
+			offset = localStat.Size()
+			_, err = remoteFile.Seek(offset, io.SeekStart)
+			if err != nil {
+				return fmt.Errorf("could not seek remote file: %v", err)
+			}
+			flags = os.O_WRONLY | os.O_APPEND
+		}
+	}
+
+	// Open local file
+	localFile, err := os.OpenFile(tmpPath, flags, 0666)
+	if err != nil {
+		return fmt.Errorf("could not create local file: %v", err)
+	}
+	defer localFile.Close()
+
+	// Copy contents, reporting progress on the terminal
+	reader := limitReader(remoteFile)
+	var progress *progressWriter
+	if showProgress && !*quietFlag && term.IsTerminal(int(os.Stderr.Fd())) {
+		progress = newProgressWriter(remotePath, remoteStat.Size()-offset)
+		reader = io.TeeReader(reader, progress)
+	}
+
+	_, err = io.Copy(localFile, reader)
+	if progress != nil {
+		progress.Finish()
+	}
+	if err != nil {
+		return fmt.Errorf("could not copy file contents: %w", err)
+	}
+	err = localFile.Sync()
+	if err != nil {
+		return fmt.Errorf("could not write local file: %v", err)
+	}
+	localFile.Close()
+
+	// Compare checksums if asked to
+	if *verifyFlag {
+		err = verifyDownload(sftp, remotePath, tmpPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = preserveLocal(tmpPath, remoteStat)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, localPath)
+	if err != nil {
+		return fmt.Errorf("could not rename local file: %v", err)
+	}
+	complete = true
+
+	if offset > 0 {
+		report.done(remoteStat.Size()-offset, "Downloaded file '%s' (resumed at %s)\n", remotePath, humanizeBytes(offset))
+	} else {
+		report.done(remoteStat.Size(), "Downloaded file '%s'\n", remotePath)
+	}
+	return nil
+}
+
+// verifyDownload compares the SHA-256 of a downloaded file with the one of
+// the remote file, removing the local copy if they differ.
+func verifyDownload(sftp *sftp.Client, remotePath, localPath string) error {
+	remoteSum, localSum, err := compareChecksums(sftp, remotePath, localPath)
+	if err != nil {
+		return err
+	}
+	if localSum != remoteSum {
+		os.Remove(localPath)
+		return fmt.Errorf("checksum mismatch for '%s' (remote %s, local %s)", remotePath, remoteSum, localSum)
+	}
+
+	return nil
+}
+
+// compareChecksums returns the SHA-256 checksums of remotePath and of
+// localPath.
+func compareChecksums(sftp *sftp.Client, remotePath, localPath string) (remoteSum, localSum string, err error) {
+	remoteFile, err := sftp.Open(remotePath)
+	if err != nil {
+		return "", "", fmt.Errorf("could not open remote file: %v", err)
+	}
+	defer remoteFile.Close()
+
+	remoteSum, err = sha256Sum(remoteFile)
+	if err != nil {
+		return "", "", fmt.Errorf("could not compute remote checksum: %v", err)
+	}
+
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return "", "", fmt.Errorf("could not open local file: %v", err)
+	}
+	defer localFile.Close()
+
+	localSum, err = sha256Sum(localFile)
+	if err != nil {
+		return "", "", fmt.Errorf("could not compute local checksum: %v", err)
+	}
+	return remoteSum, localSum, nil
+}
+
+// errUploadMismatch tells that an uploaded file differs from the local one.
+var errUploadMismatch = errors.New("uploaded file differs from the local one")
+
+// verifyUpload compares the size of the uploaded remotePath with the size of
+// localPath, and with --verify their SHA-256 checksums.
+func verifyUpload(sftp *sftp.Client, localPath, remotePath string, size int64) error {
+	remoteStat, err := sftp.Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("could not get remote file info: %v", err)
+	}
+	if remoteStat.Size() != size {
+		return fmt.Errorf("%w: '%s' is %d bytes on the server, %d locally", errUploadMismatch, localPath, remoteStat.Size(), size)
+	}
+	if !*verifyFlag {
+		return nil
+	}
+
+	remoteSum, localSum, err := compareChecksums(sftp, remotePath, localPath)
+	if err != nil {
+		return err
+	}
+	if localSum != remoteSum {
+		return fmt.Errorf("%w: checksum of '%s' is %s on the server, %s locally", errUploadMismatch, localPath, remoteSum, localSum)
+	}
+	return nil
+}
+
+// sha256Sum returns the hex encoded SHA-256 of everything read from r.
+func sha256Sum(r io.Reader) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, r)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// progressWriter counts the bytes written to it and periodically reports
+// the progress of a transfer on stderr.
+type progressWriter struct {
+	name     string
+	total    int64
+	written  int64
+	start    time.Time
+	lastShow time.Time
+}
+
+func newProgressWriter(name string, total int64) *progressWriter {
+	now := time.Now()
+	return &progressWriter{name: name, total: total, start: now, lastShow: now}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	if time.Since(p.lastShow) >= 500*time.Millisecond {
+		p.show()
+		p.lastShow = time.Now()
+	}
+	return len(b), nil
+}
+
+// Finish prints the final state of the transfer and ends the progress line.
+func (p *progressWriter) Finish() {
+	p.show()
+	fmt.Fprintln(os.Stderr)
+}
+
+func (p *progressWriter) show() {
+	percent := 100.0
+	if p.total > 0 {
+		percent = float64(p.written) * 100 / float64(p.total)
+	}
+
+	var rate int64
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = int64(float64(p.written) / elapsed)
+	}
+
+	fmt.Fprintf(os.Stderr, "\r%s: %s / %s (%3.0f%%) %s/s   ", p.name,
+		humanizeBytes(p.written), humanizeBytes(p.total), percent, humanizeBytes(rate))
+}
+
+// downloadDirectory downloads the remotePath tree to localPath, leaving out
+// the entries filtered by --include and --exclude relative to repoPath and
+// the files filtered by --since, --min-size and --max-size.
+func downloadDirectory(pool *sftpPool, remotePath, localPath, repoPath string) error {
+	return downloadTree(pool, remotePath, localPath, repoPath, nil)
+}
+
+// downloadTree downloads remotePath to localPath like downloadDirectory,
+// ancestors being the real paths of the trees downloaded above remotePath
+// through followed symbolic links, to detect loops.
+func downloadTree(pool *sftpPool, remotePath, localPath, repoPath string, ancestors []string) error {
+	// Walk with the main session, the files are downloaded over the pool
+	sftp := pool.main
+
+	// Create local directory
+	err := makeLocalDirectory(localPath)
+	if err != nil {
+		return err
+	}
+
+	// Walk what remotePath points to, as walks do not enter links, while
+	// naming the entries after remotePath
+	walkPath, err := resolveRemotePath(sftp, remotePath)
+	if err != nil {
+		return fmt.Errorf("could not resolve remote path: %v", err)
+	}
+	if *followFlag {
+		ancestors = append(ancestors, walkPath)
+	}
+
+	// List remote directory contents, creating directories as we go and
+	// collecting the files to download
+	var jobs []transferJob
+	var dirs []transferJob
+	var linkedDirs []transferJob
+	dirInfos := map[string]os.FileInfo{}
+	walker := sftp.Walk(walkPath)
+	for walker.Step() {
+		if walker.Err() != nil {
+			return fmt.Errorf("error walking remote directory: %v", walker.Err())
+		}
+
+		relPath := walker.Path()[len(walkPath):]
+		localItemPath := filepath.Join(localPath, relPath)
+		remoteItemPath := remotePath + relPath
+
+		if relPath != "" && skipEntry(relativePath(repoPath, remoteItemPath), walker.Stat().IsDir()) {
+			if walker.Stat().IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+
+		// Symbolic links are not walked into, keep them as links or queue
+		// what they point to
+		if walker.Stat().Mode()&os.ModeSymlink != 0 {
+			if !*followFlag {
+				err = downloadLink(sftp, remoteItemPath, localItemPath)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			info, err := sftp.Stat(remoteItemPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: skipping broken symbolic link '%s'\n", remoteItemPath)
+				continue
+			}
+			job := transferJob{remotePath: remoteItemPath, localPath: localItemPath}
+			if info.IsDir() {
+				linkedDirs = append(linkedDirs, job)
+			} else if !skipFile(remoteItemPath, info) {
+				jobs = append(jobs, job)
+			}
+			continue
+		}
+
+		if walker.Stat().IsDir() {
+			logf(logVerbose, "Walking '%s'\n", remoteItemPath)
+			if relPath != "" {
+				err = makeLocalDirectory(localItemPath)
+				if err != nil {
+					return err
+				}
+			}
+			dirs = append(dirs, transferJob{remotePath: remoteItemPath, localPath: localItemPath})
+			dirInfos[remoteItemPath] = walker.Stat()
+		} else if !skipFile(remoteItemPath, walker.Stat()) {
+			jobs = append(jobs, transferJob{remotePath: remoteItemPath, localPath: localItemPath})
+		}
+	}
+
+	err = downloadFiles(pool, jobs)
+	if err != nil {
+		return err
+	}
+
+	// Folders reached through links, unless they hold the link itself
+	for _, job := range linkedDirs {
+		realPath, err := resolveRemotePath(sftp, job.remotePath)
+		if err != nil {
+			return fmt.Errorf("could not resolve remote path: %v", err)
+		}
+		if isLinkLoop(realPath, ancestors) {
+			fmt.Fprintf(os.Stderr, "Warning: skipping '%s', symbolic link loop\n", job.remotePath)
+			continue
+		}
+		err = downloadTree(pool, job.remotePath, job.localPath, repoPath, ancestors)
+		if err != nil {
+			return err
+		}
+	}
+	if *dryRunFlag {
+		return nil
+	}
+
+	// Directory modes and times last, once their contents are written
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err = preserveLocal(dirs[i].localPath, dirInfos[dirs[i].remotePath])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadLink recreates the remote symbolic link remotePath at localPath,
+// with the same target.
+func downloadLink(sftp *sftp.Client, remotePath, localPath string) error {
+	target, err := sftp.ReadLink(remotePath)
+	if err != nil {
+		return fmt.Errorf("could not read remote link: %v", err)
+	}
+	if *dryRunFlag {
+		fmt.Printf("Would link '%s' to '%s'\n", localPath, target)
+		return nil
+	}
+
+	err = makeLocalLink(target, localPath)
+	if err != nil {
+		return fmt.Errorf("could not create local link: %v", err)
+	}
+	infof("Linked '%s' to '%s'\n", localPath, target)
+	return nil
+}
+
+// resolveRemotePath returns the real path of remotePath, following the links
+// it ends with first, as the realpath of some servers does not.
+func resolveRemotePath(sftp *sftp.Client, remotePath string) (string, error) {
+	for i := 0; i < maxLinkDepth; i++ {
+		info, err := sftp.Lstat(remotePath)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return sftp.RealPath(remotePath)
+		}
+
+		target, err := sftp.ReadLink(remotePath)
+		if err != nil {
+			return "", err
+		}
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(remotePath), target)
+		}
+		remotePath = target
+	}
+	return "", errors.New("too many levels of symbolic links")
+}
+
+// isLinkLoop tells whether a link to the real path target would lead back
+// to one of ancestors, or above them, or nests too many links.
+func isLinkLoop(target string, ancestors []string) bool {
+	if len(ancestors) > maxLinkDepth {
+		return true
+	}
+	target = strings.TrimSuffix(target, "/") + "/"
+	for _, ancestor := range ancestors {
+		if strings.HasPrefix(ancestor+"/", target) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxLinkDepth is the number of nested symbolic links followed before giving
+// up, like the system does.
+const maxLinkDepth = 40
+
+// transferJob is a single file to transfer between the repository and the
+// local filesystem.
+type transferJob struct {
+	remotePath string
+	localPath  string
+}
+
+// downloadFiles downloads files through --parallel workers sharing the SFTP
+// sessions of pool, and returns the first error met.
+func downloadFiles(pool *sftpPool, jobs []transferJob) error {
+	workers := *parallelFlag
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobCh := make(chan transferJob)
+	errCh := make(chan error, len(jobs))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				// Progress lines of parallel downloads would overwrite each other
+				sftp := pool.get()
+				err := downloadFile(sftp, job.remotePath, job.localPath, workers == 1)
+				pool.put(sftp)
+				if err != nil {
+					errCh <- err
+				}
+			}
+		}()
+	}
+
+	// Hand out the jobs, stopping at the first failure
+	var firstErr error
+feed:
+	for _, job := range jobs {
+		select {
+		case jobCh <- job:
+		case firstErr = <-errCh:
+			break feed
+		}
+	}
+	close(jobCh)
+	wg.Wait()
+	close(errCh)
+
+	if firstErr == nil {
+		firstErr = <-errCh
+	}
+	return firstErr
+}
+
+// uploadFile uploads localPath to remotePath, trying again on transient
+// errors.
+func uploadFile(sftp *sftp.Client, localPath, remotePath string) error {
+	report := startTransfer("upload", localPath, remotePath)
+	err := retry(fmt.Sprintf("Upload of '%s'", localPath), func() error {
+		return retryMismatch(func() error {
+			return tryUploadFile(sftp, localPath, remotePath, report)
+		})
+	})
+	report.fail(err)
+	return err
+}
+
+// retryMismatch runs upload once more if the file arrives different from
+// the local one.
+func retryMismatch(upload func() error) error {
+	err := upload()
+	if errors.Is(err, errUploadMismatch) {
+		logf(logInfo, "%v, uploading it again\n", err)
+		err = upload()
+	}
+	return err
+}
+
+func tryUploadFile(sftp *sftp.Client, localPath, remotePath string, report *transferReport) error {
+	if *dryRunFlag {
+		fmt.Printf("Would upload '%s' to '%s'\n", localPath, remotePath)
+		return nil
+	}
+
+	logf(logVerbose, "Uploading '%s' to '%s'\n", localPath, remotePath)
+
+	// Open local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("could not open local file: %v", err)
+	}
+	defer localFile.Close()
+
+	// Create remote temporary file, renamed into place once complete
+	tmpPath := tempPath(remotePath)
+	remoteFile, err := sftp.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("could not create remote file: %w", err)
+	}
+	complete := false
+	defer func() {
+		remoteFile.Close()
+		if !complete {
+			sftp.Remove(tmpPath)
+		}
+	}()
+
+	// Copy contents
+	_, err = io.Copy(remoteFile, limitReader(localFile))
+	if err != nil {
+		return fmt.Errorf("could not copy file contents: %w", err)
+	}
+	err = remoteFile.Close()
+	if err != nil {
+		return fmt.Errorf("could not write remote file: %w", err)
+	}
+
+	localStat, err := localFile.Stat()
+	if err != nil {
+		return fmt.Errorf("could not get local file info: %v", err)
+	}
+
+	// Check what arrived before it replaces the remote file
+	err = verifyUpload(sftp, localPath, tmpPath, localStat.Size())
+	if err != nil {
+		return err
+	}
+
+	err = preserveRemote(sftp, tmpPath, localStat)
+	if err != nil {
+		return err
+	}
+
+	err = renameRemote(sftp, tmpPath, remotePath)
+	if err != nil {
+		return err
+	}
+	complete = true
 
-		if remoteStat.IsDir() {
-			err = downloadDirectory(sftp, remotePath, localPath)
-		} else {
-			err = downloadFile(sftp, remotePath, localPath)
-		}
+	report.done(localStat.Size(), "Uploaded file '%s'\n", localPath)
+	return nil
+}
 
+// renameRemote moves tmpPath over remotePath. Plain SFTP renames do not
+// replace existing files, so the OpenSSH extension that does is preferred.
+func renameRemote(sftp *sftp.Client, tmpPath, remotePath string) error {
+	err := sftp.PosixRename(tmpPath, remotePath)
+	if err != nil {
+		sftp.Remove(remotePath)
+		err = sftp.Rename(tmpPath, remotePath)
 		if err != nil {
-			fmt.Printf("Error during 'get' operation: %v\n", err)
-			os.Exit(1)
+			return fmt.Errorf("could not rename remote file: %v", err)
 		}
-	default:
-		fmt.Printf("Repository type '%s' not implemented yet for 'get'.\n", repo.Type)
-		return
 	}
+	return nil
 }
 
-func putRepository(config *Config, name string) {
-	// Get current repository
-	repo := config.Repositories[config.Current]
+// uploadDirectory uploads the localPath tree to remotePath, leaving out the
+// entries filtered by --include and --exclude relative to repoPath and the
+// files filtered by --since, --min-size and --max-size.
+func uploadDirectory(sftp *sftp.Client, localPath, remotePath, repoPath string) error {
+	var dirs []string
+	dirInfos := map[string]os.FileInfo{}
 
-	switch repo.Type {
-	case "local", "network":
-		// Get source and destination paths
-		srcPath, err := filepath.Abs(name)
+	// Walk local directory contents
+	err := filepath.Walk(localPath, func(localItemPath string, info os.FileInfo, err error) error {
 		if err != nil {
-			fmt.Println("Error getting absolute path:", err)
-			os.Exit(1)
+			return fmt.Errorf("error walking local directory: %v", err)
 		}
-		destPath := filepath.Join(repo.Path, name)
 
-		// Copy file or folder
-		err = copy(srcPath, destPath)
-		if err != nil {
-			fmt.Println("Error putting file or folder:", err)
-			os.Exit(1)
-		}
-	case "ssh":
-		// Get SSH client
-		client, err := getSSHClient(&repo)
+		relPath, err := filepath.Rel(localPath, localItemPath)
 		if err != nil {
-			fmt.Println("Error connecting to SSH server:", err)
-			os.Exit(1)
+			return err
 		}
-		defer client.Close()
+		remoteItemPath := path.Join(remotePath, filepath.ToSlash(relPath))
 
-		// Get local and remote paths
-		localPath, err := filepath.Abs(name)
-		if err != nil {
-			fmt.Println("Error getting absolute path:", err)
-			os.Exit(1)
+		if relPath != "." && skipEntry(relativePath(repoPath, remoteItemPath), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
-		remotePath := filepath.ToSlash(filepath.Join(repo.Path, name))
 
-		// Upload file
-		err = client.Upload(localPath, remotePath)
-		if err != nil {
-			fmt.Println("Error uploading file:", err)
-			os.Exit(1)
+		if info.IsDir() {
+			logf(logVerbose, "Walking '%s'\n", localItemPath)
+			if *dryRunFlag {
+				fmt.Printf("Would create directory '%s'\n", remoteItemPath)
+				return nil
+			}
+
+			err = sftp.MkdirAll(remoteItemPath)
+			if err != nil {
+				return fmt.Errorf("could not create remote directory: %v", err)
+			}
+			infof("Created directory '%s'\n", remoteItemPath)
+			dirs = append(dirs, remoteItemPath)
+			dirInfos[remoteItemPath] = info
+			return nil
 		}
-	default:
-		fmt.Printf("Repository type '%s' not implemented yet for 'put'.\n", repo.Type)
-		return
-	}
-}
 
-func copy(src, dest string) error {
-	// Get source info
-	srcInfo, err := os.Stat(src)
+		if skipFile(localItemPath, info) {
+			return nil
+		}
+		return uploadFile(sftp, localItemPath, remoteItemPath)
+	})
 	if err != nil {
 		return err
 	}
 
-	// Check if source is a directory
-	if srcInfo.IsDir() {
-		// Create destination directory
-		err = os.MkdirAll(dest, srcInfo.Mode())
+	// Directory modes and times last, once their contents are written
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err = preserveRemote(sftp, dirs[i], dirInfos[dirs[i]])
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		// Get directory contents
-		files, err := ioutil.ReadDir(src)
-		if err != nil {
-			return err
-		}
+// tempPath returns the path a file is written to before being renamed to
+// filePath, so that failed transfers never leave a partial file behind.
+func tempPath(filePath string) string {
+	return filePath + ".0s-tmp"
+}
 
-		// Copy directory contents
-		for _, file := range files {
-			srcPath := filepath.Join(src, file.Name())
-			destPath := filepath.Join(dest, file.Name())
-			err = copy(srcPath, destPath)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		// Open source file
-		srcFile, err := os.Open(src)
-		if err != nil {
-			return err
+// writeLocalFile writes the contents of r to localPath through a temporary
+// file. The permissions and modification time of info are applied unless
+// info is nil.
+func writeLocalFile(localPath string, r io.Reader, info os.FileInfo) error {
+	tmpPath := tempPath(localPath)
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	complete := false
+	defer func() {
+		tmpFile.Close()
+		if !complete {
+			os.Remove(tmpPath)
 		}
-		defer srcFile.Close()
+	}()
 
-		// Create destination file
-		destFile, err := os.Create(dest)
-		if err != nil {
-			return err
-		}
-		defer destFile.Close()
+	_, err = io.Copy(tmpFile, limitReader(r))
+	if err != nil {
+		return err
+	}
+	err = tmpFile.Sync()
+	if err != nil {
+		return err
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return err
+	}
 
-		// Copy file contents
-		_, err = io.Copy(destFile, srcFile)
+	if info != nil {
+		err = preserveLocal(tmpPath, info)
 		if err != nil {
 			return err
 		}
 	}
 
+	err = os.Rename(tmpPath, localPath)
+	if err != nil {
+		return err
+	}
+	complete = true
 	return nil
 }
 
-func printUsage() {
-	fmt.Printf("0s %s.%s-%s - https://github.com/jplozf/0s\n", majorVersion, minorVersion, gitCommit)
-	fmt.Printf("Configuration file can be found at %s\n", configFilePath)
-	fmt.Println("")
-	fmt.Println("Usage: 0s <command>")
-	fmt.Println("Commands:")
-	fmt.Println("  list       - List all available repositories")
-	fmt.Println("  set <repo> - Set the current repository")
-	fmt.Println("  show       - Show files in the current repository")
-	fmt.Println("  cd <dir>   - Change the current directory for the repository")
-	fmt.Println("  get <name> - Get a file or folder from the current repository")
-	fmt.Println("  put <name> - Put a file or folder in the current repository")
-}
+// preserveLocal gives localPath the permissions and modification time of
+// info, unless --no-perms was given.
+func preserveLocal(localPath string, info os.FileInfo) error {
+	if *noPermsFlag {
+		return nil
+	}
 
-func getSSHClient(repo *Repository) (*goph.Client, error) {
-	var auth goph.Auth
-	var err error
+	err := os.Chmod(localPath, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("could not set permissions: %v", err)
+	}
+	err = os.Chtimes(localPath, info.ModTime(), info.ModTime())
+	if err != nil {
+		return fmt.Errorf("could not set modification time: %v", err)
+	}
+	return nil
+}
 
-	// Use password auth if provided, otherwise use public key auth.
-	if repo.Password != "" {
-		auth = goph.Password(repo.Password)
-	} else {
-		auth, err = goph.Key(repo.PrivateKey, "")
-		if err != nil {
-			return nil, err
-		}
+// preserveRemote gives remotePath the permissions and modification time of
+// info, unless --no-perms was given.
+func preserveRemote(sftp *sftp.Client, remotePath string, info os.FileInfo) error {
+	if *noPermsFlag {
+		return nil
 	}
 
-	// Create new SSH client
-	client, err := goph.NewConn(&goph.Config{
-		User:     repo.User,
-		Addr:     repo.Host,
-		Port:     repo.Port,
-		Auth:     auth,
-		Callback: ssh.InsecureIgnoreHostKey(),
-	})
+	err := sftp.Chmod(remotePath, info.Mode().Perm())
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("could not set remote permissions: %v", err)
+	}
+	err = sftp.Chtimes(remotePath, info.ModTime(), info.ModTime())
+	if err != nil {
+		return fmt.Errorf("could not set remote modification time: %v", err)
 	}
+	return nil
+}
 
-	return client, nil
+// joinPath joins elem to base like filepath.Join, but keeps the \\server\share
+// root of UNC paths intact and never walks above it.
+func joinPath(base, elem string) string {
+	root := uncRoot(base)
+	if root == "" {
+		return filepath.Join(base, elem)
+	}
+	rest := strings.TrimPrefix(strings.ReplaceAll(base[len(root):], `\`, "/"), "/")
+
+	// Join below the root, ".." cannot climb above it
+	joined := path.Join("/", rest, strings.ReplaceAll(elem, `\`, "/"))
+	if joined == "/" {
+		return root
+	}
+	return root + strings.ReplaceAll(joined, "/", `\`)
 }
 
-func downloadFile(sftp *sftp.Client, remotePath, localPath string) error {
-	// Open remote file
-	remoteFile, err := sftp.Open(remotePath)
-	if err != nil {
-		return fmt.Errorf("could not open remote file: %v", err)
+// uncRoot returns the \\server\share root of a UNC path, empty for other
+// paths.
+func uncRoot(p string) string {
+	if !strings.HasPrefix(p, `\\`) {
+		return ""
 	}
-	defer remoteFile.Close()
+	parts := strings.SplitN(strings.ReplaceAll(p[2:], `\`, "/"), "/", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return `\\` + parts[0] + `\` + parts[1]
+}
 
-	// Create local file
-	localFile, err := os.Create(localPath)
-	if err != nil {
-		return fmt.Errorf("could not create local file: %v", err)
+// localTarget returns the local directory 'cd newDir' leads to from
+// current, with ".." resolved. A newDir starting with a separator starts
+// from root, or if empty from the root of current, its volume or UNC share.
+func localTarget(root, current, newDir string) string {
+	if root == "" && (filepath.VolumeName(newDir) != "" || strings.HasPrefix(newDir, `\\`)) {
+		return filepath.Clean(newDir)
 	}
-	defer localFile.Close()
+	if strings.HasPrefix(newDir, "/") || strings.HasPrefix(newDir, `\`) {
+		if root == "" {
+			root = filepath.VolumeName(current) + string(filepath.Separator)
+			if unc := uncRoot(current); unc != "" {
+				root = unc
+			}
+		}
+		return joinPath(root, newDir)
+	}
+	return joinPath(current, newDir)
+}
 
-	// Copy contents
-	_, err = io.Copy(localFile, remoteFile)
-	if err != nil {
-		return fmt.Errorf("could not copy file contents: %v", err)
+// slashTarget returns the slash separated directory 'cd newDir' leads to
+// from current, with ".." resolved. An absolute newDir starts from root, or
+// replaces current if root is empty.
+func slashTarget(root, current, newDir string) string {
+	newDir = filepath.ToSlash(newDir)
+	if path.IsAbs(newDir) {
+		if root == "" {
+			return path.Clean(newDir)
+		}
+		return path.Join(root, newDir)
+	}
+	return path.Join(current, newDir)
+}
+
+// repositoryRoot returns the root of repo, as a key prefix for object
+// stores.
+func repositoryRoot(repo *Repository) string {
+	switch repo.Type {
+	case "s3", "gcs", "azureblob":
+		return objectKey("", repo.Root)
 	}
+	return repo.Root
+}
 
-	fmt.Printf("Downloaded file '%s'\n", remotePath)
-	return nil
+// withinRoot tells whether dir is root or one of its subdirectories.
+func withinRoot(root, dir string) bool {
+	root = strings.TrimRight(root, `/\`)
+	return root == "" || dir == root || strings.HasPrefix(dir, root+"/") || strings.HasPrefix(dir, root+`\`)
 }
 
-func downloadDirectory(sftp *sftp.Client, remotePath, localPath string) error {
-	// Create local directory
-	err := os.MkdirAll(localPath, os.ModePerm)
+// isGlob tells whether name contains wildcard characters.
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// exists tells whether name exists with lstat, so that names holding
+// wildcard characters such as "report [v2].txt" are not taken as patterns.
+func exists(lstat func(string) (os.FileInfo, error), name string) bool {
+	_, err := lstat(name)
+	return err == nil
+}
+
+// sshPath joins name to the path of an SSH repository. Remote paths always
+// use slashes, whatever the local separator, and SFTP passes them as is
+// without any shell, so spaces and special characters need no quoting.
+func sshPath(repo *Repository, name string) string {
+	return path.Join(repo.Path, filepath.ToSlash(name))
+}
+
+// expandGlob expands pattern with glob and returns the matches relative to dir.
+func expandGlob(glob func(string) ([]string, error), dir, pattern string) ([]string, error) {
+	matches, err := glob(pattern)
 	if err != nil {
-		return fmt.Errorf("could not create local directory: %v", err)
+		return nil, fmt.Errorf("invalid pattern '%s': %v", pattern, err)
+	}
+	if len(matches) == 0 {
+		if rel, err := filepath.Rel(dir, pattern); err == nil {
+			pattern = rel
+		}
+		return nil, fmt.Errorf("no match for pattern '%s'", pattern)
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		name, err := filepath.Rel(dir, match)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// needsConfirmation tells whether destructive operations should be
+// confirmed, which is when stdin is a terminal and --force was not given.
+func needsConfirmation() bool {
+	return !*forceFlag && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// countLocalFiles returns the number of files below dirPath.
+func countLocalFiles(dirPath string) (int, error) {
+	count := 0
+	err := filepath.Walk(dirPath, func(itemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// countRemoteFiles returns the number of files below remotePath.
+func countRemoteFiles(sftp *sftp.Client, remotePath string) (int, error) {
+	count := 0
+	walker := sftp.Walk(remotePath)
+	for walker.Step() {
+		if walker.Err() != nil {
+			return 0, walker.Err()
+		}
+		if !walker.Stat().IsDir() {
+			count++
+		}
 	}
-	fmt.Printf("Created directory '%s'\n", localPath)
+	return count, nil
+}
 
-	// List remote directory contents
+func removeRemoteDirectory(sftp *sftp.Client, remotePath string) error {
+	var dirs []string
+
+	// Remove files while walking, remember directories for later
 	walker := sftp.Walk(remotePath)
 	for walker.Step() {
 		if walker.Err() != nil {
 			return fmt.Errorf("error walking remote directory: %v", walker.Err())
 		}
 
-		relPath := walker.Path()[len(remotePath):]
-		if relPath == "" {
+		if walker.Stat().IsDir() {
+			dirs = append(dirs, walker.Path())
 			continue
 		}
 
-		localItemPath := filepath.Join(localPath, relPath)
-		remoteItemPath := walker.Path()
+		if *dryRunFlag {
+			fmt.Printf("Would remove '%s'\n", walker.Path())
+			continue
+		}
 
-		if walker.Stat().IsDir() {
-			err = os.MkdirAll(localItemPath, os.ModePerm)
-			if err != nil {
-				return fmt.Errorf("could not create local subdirectory: %v", err)
-			}
-			fmt.Printf("Created directory '%s'\n", localItemPath)
-		} else {
-			err = downloadFile(sftp, remoteItemPath, localItemPath)
-			if err != nil {
-				return err
-			}
+		err := sftp.Remove(walker.Path())
+		if err != nil {
+			return fmt.Errorf("could not remove remote file: %v", err)
+		}
+		infof("Removed file '%s'\n", walker.Path())
+	}
+
+	// Remove directories, deepest first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if *dryRunFlag {
+			fmt.Printf("Would remove '%s'\n", dirs[i])
+			continue
+		}
+
+		err := sftp.RemoveDirectory(dirs[i])
+		if err != nil {
+			return fmt.Errorf("could not remove remote directory: %v", err)
 		}
 	}
 	return nil
 }
 
-func changeDirectory(config *Config, newDir string) {
-	repo := config.Repositories[config.Current]
+// makeLocalDirectory creates a local directory for a download, or only
+// reports it on a dry run.
+func makeLocalDirectory(localPath string) error {
+	if *dryRunFlag {
+		fmt.Printf("Would create directory '%s'\n", localPath)
+		return nil
+	}
+
+	err := os.MkdirAll(localPath, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("could not create local directory: %v", err)
+	}
+	infof("Created directory '%s'\n", localPath)
+	return nil
+}
+
+// getDownloadDir returns the local directory 'get' downloads to: --out, else
+// the download_dir of the repository, else the working directory. It is
+// created if missing.
+func getDownloadDir(repo *Repository) (string, error) {
+	dir := *outFlag
+	if dir == "" {
+		dir = repo.DownloadDir
+	}
+	if dir == "" {
+		return os.Getwd()
+	}
+
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = expandHome(dir, homeDir)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err = makeLocalDirectory(dir)
+		if err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// makeParentDirectory creates the missing local directory holding
+// localPath.
+func makeParentDirectory(localPath string) error {
+	if _, err := os.Stat(filepath.Dir(localPath)); err == nil {
+		return nil
+	}
+	return makeLocalDirectory(filepath.Dir(localPath))
+}
+
+func changeDirectory(config *Config, newDir string) error {
+	repo := currentRepo(config)
+	previousPath := repo.Path
+
+	// 'cd -' goes back where the last cd came from, object stores having
+	// their root at the empty key
+	back := newDir == "-"
+	isObjectStore := repo.Type == "s3" || repo.Type == "gcs" || repo.Type == "azureblob"
+	if back && repo.PreviousPath == "" && !isObjectStore {
+		return usageError(errors.New("no previous directory to return to"))
+	}
+	root := repositoryRoot(&repo)
+	target := func(join func(root, current, newDir string) string) (string, error) {
+		newPath := repo.PreviousPath
+		if !back {
+			newPath = join(root, repo.Path, newDir)
+		}
+		if !withinRoot(root, newPath) {
+			return "", usageError(fmt.Errorf("'%s' is outside of the repository root '%s'", newPath, repo.Root))
+		}
+		return newPath, nil
+	}
 
 	switch repo.Type {
 	case "local", "network":
-		newPath := filepath.Join(repo.Path, newDir)
+		newPath, err := target(localTarget)
+		if err != nil {
+			return err
+		}
 
 		// Check if the new path exists and is a directory
 		info, err := os.Stat(newPath)
 		if err != nil {
-			fmt.Printf("Error accessing path '%s': %v\n", newPath, err)
-			os.Exit(1)
+			return transferError(fmt.Errorf("cannot access path '%s': %w", newPath, err))
 		}
 		if !info.IsDir() {
-			fmt.Printf("Error: '%s' is not a directory.\n", newPath)
-			os.Exit(1)
+			return transferError(fmt.Errorf("'%s' is not a directory", newPath))
 		}
 
 		repo.Path = newPath
@@ -582,45 +5440,74 @@ func changeDirectory(config *Config, newDir string) {
 
 		client, err := getSSHClient(&repo)
 		if err != nil {
-			fmt.Println("Error connecting to SSH server:", err)
-			os.Exit(1)
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
 		}
 		defer client.Close()
 
 		sftp, err := client.NewSftp()
 		if err != nil {
-			fmt.Println("Error creating SFTP client:", err)
-			os.Exit(1)
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
 		}
 		defer sftp.Close()
 
-		// sftp.Join is not available, must use path package
-		newPath := filepath.ToSlash(filepath.Join(repo.Path, newDir))
+		newPath, err := target(slashTarget)
+		if err != nil {
+			return err
+		}
 
 		// Check if remote path exists and is a directory
 		info, err := sftp.Stat(newPath)
 		if err != nil {
-			fmt.Printf("Error accessing remote path '%s': %v\n", newPath, err)
-			os.Exit(1)
+			return transferError(fmt.Errorf("cannot access remote path '%s': %w", newPath, err))
 		}
 		if !info.IsDir() {
-			fmt.Printf("Error: remote path '%s' is not a directory.\n", newPath)
-			os.Exit(1)
+			return transferError(fmt.Errorf("remote path '%s' is not a directory", newPath))
+		}
+
+		repo.Path = newPath
+
+	case "s3", "gcs", "azureblob":
+		// Object stores have no real directories, just move the key prefix
+		newPath, err := target(func(root, current, newDir string) string {
+			return objectKey("", slashTarget("/"+root, "/"+current, newDir))
+		})
+		if err != nil {
+			return err
+		}
+		repo.Path = newPath
+
+	case "ftp":
+		client, err := getFTPClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to FTP server: %w", err))
+		}
+		defer client.Quit()
+
+		newPath, err := target(slashTarget)
+		if err != nil {
+			return err
+		}
+
+		// Check if remote path exists and is a directory
+		err = client.ChangeDir(newPath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot access remote directory '%s': %w", newPath, err))
 		}
 
 		repo.Path = newPath
 
 	default:
-		fmt.Printf("Repository type '%s' not implemented yet for 'cd'.\n", repo.Type)
-		return
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'cd'", repo.Type))
 	}
 
+	repo.PreviousPath = previousPath
 	config.Repositories[config.Current] = repo
 	err := saveConfig(config)
 	if err != nil {
-		fmt.Println("Error saving configuration:", err)
-		os.Exit(1)
+		return configError(fmt.Errorf("cannot save configuration: %w", err))
 	}
 
-	fmt.Printf("Changed directory to '%s'\n", repo.Path)
+	infof("Changed directory to '%s'\n", repo.Path)
+
+	return nil
 }
@@ -0,0 +1,501 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestJoinPathUNC(t *testing.T) {
+	tests := []struct {
+		base, elem, want string
+	}{
+		{`\\host\share\sub`, "x", `\\host\share\sub\x`},
+		{`\\host\share\sub`, "a/b", `\\host\share\sub\a\b`},
+		{`\\host\share\sub`, `a\b`, `\\host\share\sub\a\b`},
+		{`\\host\share\sub`, "..", `\\host\share`},
+		{`\\host\share\sub`, `..\..\..\x`, `\\host\share\x`},
+		{`\\host\share`, "..", `\\host\share`},
+		{`\\host\share`, "sub", `\\host\share\sub`},
+		{`\\host\share\`, ".", `\\host\share`},
+		{"/tmp/a", "../b", "/tmp/b"},
+	}
+	for _, test := range tests {
+		got := joinPath(test.base, test.elem)
+		if got != test.want {
+			t.Errorf("joinPath(%q, %q) = %q, want %q", test.base, test.elem, got, test.want)
+		}
+	}
+}
+
+func TestLocalTargetUNC(t *testing.T) {
+	tests := []struct {
+		root, current, newDir, want string
+	}{
+		{"", `\\host\share\sub`, "dir", `\\host\share\sub\dir`},
+		{"", `\\host\share\sub`, "..", `\\host\share`},
+		{"", `\\host\share`, "..", `\\host\share`},
+		{"", `\\host\share`, `..\..`, `\\host\share`},
+		{"", `\\host\share\sub\dir`, `\other`, `\\host\share\other`},
+		{"", `\\host\share\sub`, `\\other\data\x`, `\\other\data\x`},
+		{`\\host\share\sub`, `\\host\share\sub\dir`, `\top`, `\\host\share\sub\top`},
+	}
+	for _, test := range tests {
+		got := localTarget(test.root, test.current, test.newDir)
+		if got != test.want {
+			t.Errorf("localTarget(%q, %q, %q) = %q, want %q", test.root, test.current, test.newDir, got, test.want)
+		}
+	}
+}
+
+// newPipeSFTP returns an SFTP client talking to an in-process server over
+// pipes, serving the local filesystem.
+func newPipeSFTP(t *testing.T) *sftp.Client {
+	t.Helper()
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverReader, serverWriter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientReader, clientWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server side goes first, ending the reads of the client
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return client
+}
+
+func TestSSHPathSpecialNames(t *testing.T) {
+	dir := t.TempDir()
+	repo := &Repository{Type: "ssh", Path: filepath.ToSlash(dir)}
+	client := newPipeSFTP(t)
+
+	names := []string{
+		"my report (final).txt",
+		"R&D notes.txt",
+		"été 2025 — résumé.txt",
+		"report [v2].txt",
+	}
+	for _, name := range names {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		remotePath := sshPath(repo, name)
+		if want := repo.Path + "/" + name; remotePath != want {
+			t.Errorf("sshPath(%q) = %q, want %q", name, remotePath, want)
+		}
+
+		// Existing names are taken literally, even holding wildcards
+		if !exists(client.Lstat, remotePath) {
+			t.Errorf("exists(%q) = false, want true", remotePath)
+		}
+
+		file, err := client.Open(remotePath)
+		if err != nil {
+			t.Fatalf("cannot open %q: %v", remotePath, err)
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil || string(content) != name {
+			t.Errorf("content of %q = %q, %v, want %q", remotePath, content, err, name)
+		}
+	}
+
+	// Patterns match such names as well
+	matches, err := expandGlob(client.Glob, repo.Path, sshPath(repo, "my report (*).txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 || matches[0] != "my report (final).txt" {
+		t.Errorf("expandGlob matched %q, want [my report (final).txt]", matches)
+	}
+	if exists(client.Lstat, sshPath(repo, "report [v1].txt")) {
+		t.Errorf("exists(report [v1].txt) = true, want false")
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host     string
+		port     uint
+		wantHost string
+		wantAddr string
+	}{
+		{"::1", 2222, "::1", "[::1]:2222"},
+		{"[::1]", 2222, "::1", "[::1]:2222"},
+		{"[::1]:2222", 0, "::1", "[::1]:2222"},
+		{"[::1]:2222", 2200, "::1", "[::1]:2200"},
+		{"host:2222", 0, "host", "host:2222"},
+		{"host", 2222, "host", "host:2222"},
+		{"fe80::1%eth0", 22, "fe80::1%eth0", "[fe80::1%eth0]:22"},
+	}
+	for _, test := range tests {
+		repo := Repository{Type: "ssh", Host: test.host, Port: test.port}
+		normalizeHost(&repo)
+		addr := net.JoinHostPort(repo.Host, strconv.FormatUint(uint64(repo.Port), 10))
+		if repo.Host != test.wantHost || addr != test.wantAddr {
+			t.Errorf("normalizeHost(%q, %d) gave host %q, address %q, want %q, %q", test.host, test.port, repo.Host, addr, test.wantHost, test.wantAddr)
+		}
+	}
+}
+
+// newTestSSHServer starts an SSH server serving SFTP on the local
+// filesystem to user u with password pw, and returns its port.
+func newTestSSHServer(t *testing.T) uint {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "u" && string(password) == "pw" {
+				return nil, nil
+			}
+			return nil, errors.New("access denied")
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSH(conn, config)
+		}
+	}()
+	return uint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// serveTestSSH serves the sftp subsystem on the sessions of conn.
+func serveTestSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for request := range requests {
+				isSFTP := request.Type == "subsystem" && len(request.Payload) > 4 && string(request.Payload[4:]) == "sftp"
+				request.Reply(isSFTP, nil)
+				if !isSFTP {
+					continue
+				}
+				server, err := sftp.NewServer(channel)
+				if err == nil {
+					server.Serve()
+				}
+				channel.Close()
+			}
+		}()
+	}
+}
+
+// newTestSSHConfig returns a configuration whose current repository is
+// the directory repoPath of the test SSH server listening on port.
+func newTestSSHConfig(port uint, repoPath string) *Config {
+	return &Config{
+		Current: "s",
+		Repositories: map[string]Repository{
+			"s": {
+				Type:               "ssh",
+				Host:               "127.0.0.1",
+				Port:               port,
+				User:               "u",
+				Password:           "pw",
+				InsecureSkipVerify: true,
+				Path:               repoPath,
+			},
+		},
+	}
+}
+
+func TestGetSymlinks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	port := newTestSSHServer(t)
+
+	// A directory and a file, each behind a symbolic link
+	remote := t.TempDir()
+	err := os.Mkdir(filepath.Join(remote, "dir"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"dir/a.txt": "in dir", "file.txt": "file"} {
+		err = os.WriteFile(filepath.Join(remote, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"lnd": "dir", "lnf": "file.txt"} {
+		err = os.Symlink(target, filepath.Join(remote, link))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := newTestSSHConfig(port, filepath.ToSlash(remote))
+
+	defer func(out string, follow bool, level int) {
+		*outFlag, *followFlag, verbosity = out, follow, level
+	}(*outFlag, *followFlag, verbosity)
+	verbosity = logQuiet
+
+	// By default the links are recreated as such
+	*outFlag, *followFlag = t.TempDir(), false
+	for link, target := range map[string]string{"lnd": "dir", "lnf": "file.txt"} {
+		err = getRepository(config, link)
+		if err != nil {
+			t.Fatalf("get %s: %v", link, err)
+		}
+		got, err := os.Readlink(filepath.Join(*outFlag, link))
+		if err != nil || got != target {
+			t.Errorf("get %s gave link to %q, %v, want a link to %q", link, got, err, target)
+		}
+	}
+
+	// With --follow what they point to is downloaded
+	*outFlag, *followFlag = t.TempDir(), true
+	for link, file := range map[string]string{"lnd": "lnd/a.txt", "lnf": "lnf"} {
+		err = getRepository(config, link)
+		if err != nil {
+			t.Fatalf("get --follow %s: %v", link, err)
+		}
+		info, err := os.Lstat(filepath.Join(*outFlag, link))
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("get --follow %s gave %v, %v, want a copy of the target", link, info, err)
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(*outFlag, file)); err != nil {
+			t.Errorf("get --follow %s did not download %s: %v", link, file, err)
+		}
+	}
+	content, err := os.ReadFile(filepath.Join(*outFlag, "lnd", "a.txt"))
+	if err != nil || string(content) != "in dir" {
+		t.Errorf("lnd/a.txt holds %q, %v, want %q", content, err, "in dir")
+	}
+}
+
+func TestPullDotPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	port := newTestSSHServer(t)
+
+	// The repository path is ".", as after 'cd' back to the login
+	// directory, the one the test server serves from
+	remote := t.TempDir()
+	t.Chdir(remote)
+	err := os.Mkdir(filepath.Join(remote, "sub"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"abc", "x", "sub/d.txt"}
+	for _, name := range names {
+		err = os.WriteFile(filepath.Join(remote, name), []byte("remote "+name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := newTestSSHConfig(port, ".")
+
+	defer func(delete bool, level int) {
+		*deleteFlag, verbosity = delete, level
+	}(*deleteFlag, verbosity)
+	*deleteFlag, verbosity = true, logQuiet
+
+	// A stale local copy, that must be replaced and not deleted
+	local := t.TempDir()
+	err = os.WriteFile(filepath.Join(local, "abc"), []byte("old"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pullRepository(config, local)
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(local, name))
+		if err != nil || string(content) != "remote "+name {
+			t.Errorf("%s holds %q, %v, want %q", name, content, err, "remote "+name)
+		}
+	}
+	for _, name := range []string{"bc", "ub"} {
+		if _, err := os.Lstat(filepath.Join(local, name)); err == nil {
+			t.Errorf("pull created %s, a truncated name", name)
+		}
+	}
+}
+
+func TestMirrorDotPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	port := newTestSSHServer(t)
+
+	remote := t.TempDir()
+	t.Chdir(remote)
+	names := []string{"abc", "x"}
+	for _, name := range names {
+		err := os.WriteFile(filepath.Join(remote, name), []byte("remote "+name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := newTestSSHConfig(port, ".")
+
+	defer func(file string, delete bool, level int) {
+		configFilePath, *deleteFlag, verbosity = file, delete, level
+	}(configFilePath, *deleteFlag, verbosity)
+	configFilePath = filepath.Join(t.TempDir(), "config.json")
+	*deleteFlag, verbosity = true, logQuiet
+
+	// Twice, the second one against the baseline of the first
+	local := t.TempDir()
+	for i := 0; i < 2; i++ {
+		err := mirrorRepository(config, local)
+		if err != nil {
+			t.Fatalf("mirror: %v", err)
+		}
+		for _, name := range names {
+			content, err := os.ReadFile(filepath.Join(local, name))
+			if err != nil || string(content) != "remote "+name {
+				t.Errorf("mirror %d: %s holds %q, %v, want %q", i+1, name, content, err, "remote "+name)
+			}
+		}
+	}
+}
+
+func TestTransferDotPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	port := newTestSSHServer(t)
+
+	remote := t.TempDir()
+	t.Chdir(remote)
+	err := os.Mkdir(filepath.Join(remote, "sub"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"abc", "x", "sub/d.txt"}
+	for _, name := range names {
+		err = os.WriteFile(filepath.Join(remote, name), []byte("remote "+name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// From the repository at "." to another directory of the server
+	dest := t.TempDir()
+	config := newTestSSHConfig(port, ".")
+	destRepo := config.Repositories["s"]
+	destRepo.Path = filepath.ToSlash(dest)
+	config.Repositories["d"] = destRepo
+
+	defer func(level int) { verbosity = level }(verbosity)
+	verbosity = logQuiet
+
+	err = transferRepositories(config, "s:", "d:copy")
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	for _, name := range names {
+		content, err := os.ReadFile(filepath.Join(dest, "copy", name))
+		if err != nil || string(content) != "remote "+name {
+			t.Errorf("copy/%s holds %q, %v, want %q", name, content, err, "remote "+name)
+		}
+	}
+}
+
+func TestCopyFilters(t *testing.T) {
+	defer func(since time.Time, min, max int64) {
+		sinceTime, minSize, maxSize = since, min, max
+	}(sinceTime, minSize, maxSize)
+	defer func(level int) { verbosity = level }(verbosity)
+	verbosity = logQuiet
+
+	src := t.TempDir()
+	files := map[string]string{"old": "old file", "small": "s", "big": "big file, too big", "kept": "kept file"}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	week := time.Now().Add(-7 * 24 * time.Hour)
+	err := os.Chtimes(filepath.Join(src, "old"), week, week)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sinceTime = time.Now().Add(-24 * time.Hour)
+	minSize, maxSize = 2, 10
+	dest := filepath.Join(t.TempDir(), "copy")
+	err = copy(src, dest)
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(dest, name))
+		if name == "kept" {
+			if err != nil || string(got) != content {
+				t.Errorf("%s holds %q, %v, want %q", name, got, err, content)
+			}
+		} else if err == nil {
+			t.Errorf("%s copied, want it filtered out", name)
+		}
+	}
+
+	// A file named on its own is copied whatever its size or age
+	err = copy(filepath.Join(src, "old"), filepath.Join(dest, "old"))
+	if err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "old")); err != nil {
+		t.Errorf("old not copied: %v", err)
+	}
+}
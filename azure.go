@@ -0,0 +1,214 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+func getAzureClient(repo *Repository) (*azblob.Client, error) {
+	serviceURL := repo.Endpoint
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net/", repo.AccountName)
+	}
+
+	// Without a key, only public containers can be read
+	if repo.AccountKey == "" {
+		return azblob.NewClientWithNoCredential(serviceURL, nil)
+	}
+	credential, err := azblob.NewSharedKeyCredential(repo.AccountName, repo.AccountKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account key: %v", err)
+	}
+	return azblob.NewClientWithSharedKeyCredential(serviceURL, credential, nil)
+}
+
+// azureError turns the errors of the storage service that users can fix
+// into plain messages.
+func azureError(err error, repo *Repository) error {
+	switch {
+	case bloberror.HasCode(err, bloberror.ContainerNotFound):
+		return fmt.Errorf("container '%s' does not exist in account '%s'", repo.Container, repo.AccountName)
+	case bloberror.HasCode(err, bloberror.AuthenticationFailed, bloberror.AuthorizationFailure,
+		bloberror.InsufficientAccountPermissions, bloberror.NoAuthenticationInformation):
+		return fmt.Errorf("access to account '%s' denied, check account_name and account_key", repo.AccountName)
+	}
+	return err
+}
+
+func listAzureDirectory(client *azblob.Client, repo *Repository, key string) ([]os.FileInfo, error) {
+	prefix := dirPrefix(key)
+	var files []os.FileInfo
+
+	containerClient := client.ServiceClient().NewContainerClient(repo.Container)
+	pager := containerClient.NewListBlobsHierarchyPager("/", &container.ListBlobsHierarchyOptions{
+		Prefix: &prefix,
+	})
+	for pager.More() {
+		page, err := pager.NextPage(operation)
+		if err != nil {
+			return nil, azureError(err, repo)
+		}
+
+		// Prefixes stand for directories
+		for _, blobPrefix := range page.Segment.BlobPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(*blobPrefix.Name, prefix), "/")
+			files = append(files, objectInfo{name: name, dir: true})
+		}
+		for _, item := range page.Segment.BlobItems {
+			name := strings.TrimPrefix(*item.Name, prefix)
+			if name == "" {
+				continue
+			}
+			info := objectInfo{name: name}
+			if item.Properties != nil {
+				if item.Properties.ContentLength != nil {
+					info.size = *item.Properties.ContentLength
+				}
+				if item.Properties.LastModified != nil {
+					info.modTime = *item.Properties.LastModified
+				}
+			}
+			files = append(files, info)
+		}
+	}
+
+	return files, nil
+}
+
+// isAzureDirectory tells whether key is a prefix holding other blobs.
+func isAzureDirectory(client *azblob.Client, repo *Repository, key string) (bool, error) {
+	prefix := dirPrefix(key)
+	maxResults := int32(1)
+	pager := client.NewListBlobsFlatPager(repo.Container, &azblob.ListBlobsFlatOptions{
+		Prefix:     &prefix,
+		MaxResults: &maxResults,
+	})
+	page, err := pager.NextPage(operation)
+	if err != nil {
+		return false, azureError(err, repo)
+	}
+	return len(page.Segment.BlobItems) > 0, nil
+}
+
+func downloadAzureBlob(client *azblob.Client, repo *Repository, key, localPath string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would download 'azure://%s/%s' to '%s'\n", repo.Container, key, localPath)
+		return nil
+	}
+
+	logf(logVerbose, "Downloading 'azure://%s/%s' to '%s'\n", repo.Container, key, localPath)
+	report := startTransfer("download", "azure://"+repo.Container+"/"+key, localPath)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Get remote blob
+	response, err := client.DownloadStream(operation, repo.Container, key, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return fmt.Errorf("blob '%s' does not exist", key)
+		}
+		return fmt.Errorf("could not get blob: %v", azureError(err, repo))
+	}
+	defer response.Body.Close()
+
+	// Copy contents to the local file
+	err = writeLocalFile(localPath, response.Body, nil)
+	if err != nil {
+		return fmt.Errorf("could not write local file: %v", err)
+	}
+
+	report.done(localSize(localPath), "Downloaded blob '%s'\n", key)
+	return nil
+}
+
+func downloadAzureDirectory(client *azblob.Client, repo *Repository, key, localPath string) error {
+	prefix := dirPrefix(key)
+
+	pager := client.NewListBlobsFlatPager(repo.Container, &azblob.ListBlobsFlatOptions{
+		Prefix: &prefix,
+	})
+	for pager.More() {
+		page, err := pager.NextPage(operation)
+		if err != nil {
+			return fmt.Errorf("error listing blobs: %v", azureError(err, repo))
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			relPath := strings.TrimPrefix(*item.Name, prefix)
+			if relPath == "" || strings.HasSuffix(relPath, "/") {
+				continue
+			}
+
+			localItemPath := filepath.Join(localPath, filepath.FromSlash(relPath))
+			err = makeLocalDirectory(filepath.Dir(localItemPath))
+			if err != nil {
+				return err
+			}
+
+			err = downloadAzureBlob(client, repo, *item.Name, localItemPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func uploadAzureBlob(client *azblob.Client, repo *Repository, localPath, key string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would upload '%s' to 'azure://%s/%s'\n", localPath, repo.Container, key)
+		return nil
+	}
+
+	logf(logVerbose, "Uploading '%s' to 'azure://%s/%s'\n", localPath, repo.Container, key)
+	report := startTransfer("upload", localPath, "azure://"+repo.Container+"/"+key)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Open local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("could not open local file: %v", err)
+	}
+	defer localFile.Close()
+
+	// Stream to the remote blob, committed once all blocks are sent
+	_, err = client.UploadStream(operation, repo.Container, key, limitReader(localFile), nil)
+	if err != nil {
+		return fmt.Errorf("could not put blob: %v", azureError(err, repo))
+	}
+
+	report.done(localSize(localPath), "Uploaded file '%s'\n", localPath)
+	return nil
+}
+
+func uploadAzureDirectory(client *azblob.Client, repo *Repository, localPath, key string) error {
+	// Walk local directory contents, blob containers have no real directories
+	return filepath.Walk(localPath, func(localItemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking local directory: %v", err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(localPath, localItemPath)
+		if err != nil {
+			return err
+		}
+
+		return uploadAzureBlob(client, repo, localItemPath, objectKey(key, relPath))
+	})
+}
@@ -0,0 +1,66 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// broadcastRepositories uploads the local file or folder name to every
+// repository of the comma separated repoList at once, as 'put' would to
+// each of them. It reports the outcome per repository and fails if any
+// upload failed.
+func broadcastRepositories(config *Config, name, repoList string) error {
+	var names []string
+	seen := map[string]bool{}
+	for _, repoName := range strings.Split(repoList, ",") {
+		repoName = strings.TrimSpace(repoName)
+		if repoName == "" || seen[repoName] {
+			continue
+		}
+		if _, ok := config.Repositories[repoName]; !ok {
+			return configError(fmt.Errorf("repository '%s' not found", repoName))
+		}
+		seen[repoName] = true
+		names = append(names, repoName)
+	}
+	if len(names) == 0 {
+		return usageError(errors.New("please specify the repositories to upload to"))
+	}
+
+	// Each upload works on its own copy of the configuration, only the
+	// current repository differs
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, repoName := range names {
+		wg.Add(1)
+		go func(i int, repoName string) {
+			defer wg.Done()
+			target := *config
+			target.Current = repoName
+			errs[i] = putRepository(&target, name)
+		}(i, repoName)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, repoName := range names {
+		repo := config.Repositories[repoName]
+		if errs[i] != nil {
+			fmt.Printf("FAIL  %s (%s): %v\n", repoName, repo.Type, errs[i])
+			failed++
+			continue
+		}
+		fmt.Printf("OK    %s (%s)\n", repoName, repo.Type)
+	}
+	fmt.Printf("%d repositories, %d succeeded, %d failed\n", len(names), len(names)-failed, failed)
+
+	if failed > 0 {
+		return transferError(fmt.Errorf("'broadcast' failed for %d repositories", failed))
+	}
+	return nil
+}
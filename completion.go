@@ -0,0 +1,122 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The completion scripts call back "0s __complete repos" for the repository
+// names and "0s __complete files" for the entries of the current repository.
+const bashCompletion = `# bash completion for 0s, load it with: source <(0s completion bash)
+_0s() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local command="" i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        if [[ "${COMP_WORDS[i]}" != -* ]]; then
+            command="${COMP_WORDS[i]}"
+            break
+        fi
+    done
+
+    if [ -z "$command" ]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+        return
+    fi
+
+    case "$command" in
+        set|remove|del-repo|rename-repo|copy-repo|ping)
+            COMPREPLY=($(compgen -W "$(0s __complete repos 2>/dev/null)" -- "$cur")) ;;
+        cd|get|rm|mv|touch|cat|head|tail|diff|edit|open|stat|info|grep|tree)
+            COMPREPLY=($(compgen -W "$(0s __complete files 2>/dev/null)" -- "$cur")) ;;
+        put|broadcast|sync|pull|mirror|clone)
+            COMPREPLY=($(compgen -f -- "$cur")) ;;
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh" -- "$cur")) ;;
+    esac
+}
+complete -F _0s 0s
+`
+
+const zshCompletion = `#compdef 0s
+# zsh completion for 0s, load it with: source <(0s completion zsh)
+_0s() {
+    local -a commands
+    commands=(%s)
+
+    local command="" word
+    for word in ${words[2,CURRENT-1]}; do
+        if [[ "$word" != -* ]]; then
+            command="$word"
+            break
+        fi
+    done
+
+    if [[ -z "$command" ]]; then
+        compadd -- $commands
+        return
+    fi
+
+    case "$command" in
+        set|remove|del-repo|rename-repo|copy-repo|ping)
+            compadd -- ${(f)"$(0s __complete repos 2>/dev/null)"} ;;
+        cd|get|rm|mv|touch|cat|head|tail|diff|edit|open|stat|info|grep|tree)
+            compadd -- ${(f)"$(0s __complete files 2>/dev/null)"} ;;
+        put|broadcast|sync|pull|mirror|clone)
+            _files ;;
+        completion)
+            compadd bash zsh ;;
+    esac
+}
+compdef _0s 0s
+`
+
+// commandNames lists the commands offered by the completion scripts.
+const commandNames = "list set add remove del-repo rename-repo copy-repo export import config show pwd whoami cd get put broadcast transfer rm mv touch cat head tail diff edit open stat info grep tree sync pull mirror clone check ping history interactive version completion"
+
+func printCompletion(shell string) error {
+	switch shell {
+	case "bash":
+		fmt.Printf(bashCompletion, commandNames)
+	case "zsh":
+		fmt.Printf(zshCompletion, commandNames)
+	default:
+		return usageError(fmt.Errorf("unsupported shell '%s', use bash or zsh", shell))
+	}
+	return nil
+}
+
+// completeRepository prints the candidates for the completion scripts, one
+// per line: the repository names for "repos", the entries of the current
+// repository for "files".
+func completeRepository(config *Config, kind string) error {
+	switch kind {
+	case "repos":
+		var names []string
+		for name := range config.Repositories {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case "files":
+		repo := currentRepo(config)
+		files, err := listFiles(&repo)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.IsDir() {
+				fmt.Println(file.Name() + "/")
+			} else {
+				fmt.Println(file.Name())
+			}
+		}
+	default:
+		return usageError(fmt.Errorf("unknown completion kind '%s'", kind))
+	}
+	return nil
+}
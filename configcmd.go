@@ -0,0 +1,156 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configCommand runs 'config get <repo> <field>' and 'config set <repo>
+// <field> <value>'. Fields are named as in the configuration file, those of
+// the jump host as jump.<field>.
+func configCommand(config *Config, args []string) error {
+	if len(args) == 0 {
+		return usageError(errors.New("please specify get or set"))
+	}
+	switch args[0] {
+	case "get":
+		if len(args) < 3 {
+			return usageError(errors.New("please specify a repository and a field to get"))
+		}
+		return getConfigField(config, args[1], args[2])
+	case "set":
+		if len(args) < 4 {
+			return usageError(errors.New("please specify a repository, a field and its value"))
+		}
+		return setConfigField(config, args[1], args[2], args[3])
+	}
+	return usageError(fmt.Errorf("unknown config command '%s', use get or set", args[0]))
+}
+
+// getConfigField prints the value of field of the repository name, secrets
+// masked unless --show-secrets is given.
+func getConfigField(config *Config, name, field string) error {
+	repo, ok := config.Repositories[name]
+	if !ok {
+		return configError(fmt.Errorf("repository '%s' not found", name))
+	}
+
+	value, err := repositoryField(&repo, field, false)
+	if err != nil {
+		return usageError(err)
+	}
+	if !value.IsValid() {
+		return nil
+	}
+
+	// Secrets, those 'export --no-secrets' leaves out, are hidden unless
+	// asked for
+	if !*secretsFlag {
+		stripped := repo
+		stripSecrets(&stripped)
+		strippedValue, _ := repositoryField(&stripped, field, false)
+		if strippedValue.Interface() != value.Interface() {
+			if strippedValue.String() == "" {
+				fmt.Println("********")
+			} else {
+				fmt.Println(strippedValue.Interface())
+			}
+			return nil
+		}
+	}
+	fmt.Println(value.Interface())
+	return nil
+}
+
+// setConfigField sets field of the repository name to value, converted to
+// the type of the field, and saves the configuration. The problems of the
+// changed repository are reported as warnings, a change may take several
+// steps.
+func setConfigField(config *Config, name, field, value string) error {
+	repo, ok := config.Repositories[name]
+	if !ok {
+		return configError(fmt.Errorf("repository '%s' not found", name))
+	}
+
+	// The jump host is the only setting not held by value
+	if repo.Jump != nil {
+		jump := *repo.Jump
+		repo.Jump = &jump
+	}
+
+	target, err := repositoryField(&repo, field, true)
+	if err != nil {
+		return usageError(err)
+	}
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return usageError(fmt.Errorf("invalid value '%s' for '%s', expected true or false", value, field))
+		}
+		target.SetBool(b)
+	case reflect.Uint:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return usageError(fmt.Errorf("invalid value '%s' for '%s', expected a number", value, field))
+		}
+		if (field == "port" || field == "jump.port") && (n < 1 || n > 65535) {
+			return usageError(fmt.Errorf("invalid port %d, expected 1 to 65535", n))
+		}
+		target.SetUint(n)
+	default:
+		return usageError(fmt.Errorf("'%s' cannot be set with config set", field))
+	}
+
+	config.Repositories[name] = repo
+	err = saveConfig(config)
+	if err != nil {
+		return configError(fmt.Errorf("cannot save configuration: %w", err))
+	}
+	infof("Set '%s' of repository '%s'.\n", field, name)
+
+	for _, problem := range validateRepository(&repo) {
+		fmt.Fprintf(os.Stderr, "Warning: repository '%s': %v\n", name, problem)
+	}
+	return nil
+}
+
+// repositoryField returns the field of repo named by its JSON name, or by
+// jump.<name> for the jump host, which is added if create is set. An unset
+// jump host has no value.
+func repositoryField(repo *Repository, field string, create bool) (reflect.Value, error) {
+	if jumpField, ok := strings.CutPrefix(field, "jump."); ok {
+		if repo.Jump == nil {
+			if !create {
+				return reflect.Value{}, nil
+			}
+			repo.Jump = &Repository{Type: "ssh"}
+		}
+		return repositoryField(repo.Jump, jumpField, create)
+	}
+
+	value := reflect.ValueOf(repo).Elem()
+	var names []string
+	for i := 0; i < value.NumField(); i++ {
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if name == field && value.Field(i).Kind() != reflect.Ptr {
+			return value.Field(i), nil
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return reflect.Value{}, fmt.Errorf("unknown field '%s', use one of %s or jump.<field>", field, strings.Join(names, ", "))
+}
@@ -0,0 +1,64 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofrs/flock"
+)
+
+// configLockTimeout is how long to wait for another 0s to be done with the
+// configuration.
+const configLockTimeout = 10 * time.Second
+
+// configLocked tells whether the running command holds the configuration
+// lock from loading the configuration to saving it.
+var configLocked bool
+
+// changesConfig tells whether command loads, changes and saves the
+// configuration, which must not interleave with another 0s doing the same.
+func changesConfig(command string) bool {
+	switch command {
+	case "set", "add", "remove", "del-repo", "rename-repo", "copy-repo", "import", "config", "cd":
+		return true
+	}
+	return false
+}
+
+// lockConfig waits for the advisory lock on the configuration, kept in a
+// file next to it, shared for reading or exclusive for writing. It returns
+// the function releasing the lock.
+func lockConfig(exclusive bool) (func(), error) {
+	err := os.MkdirAll(filepath.Dir(configFilePath), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := flock.New(configFilePath + ".lock")
+	ctx, cancel := context.WithTimeout(context.Background(), configLockTimeout)
+	defer cancel()
+
+	var locked bool
+	if exclusive {
+		locked, err = lock.TryLockContext(ctx, 100*time.Millisecond)
+	} else {
+		locked, err = lock.TryRLockContext(ctx, 100*time.Millisecond)
+	}
+	if !locked {
+		if err == nil || errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("configuration '%s' still in use by another 0s after %v", configFilePath, configLockTimeout)
+		}
+		return nil, fmt.Errorf("cannot lock configuration: %w", err)
+	}
+
+	return func() {
+		lock.Unlock()
+	}, nil
+}
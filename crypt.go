@@ -0,0 +1,217 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedPrefix marks the configuration values encrypted with the master key.
+const encryptedPrefix = "enc:"
+
+const saltSize = 16
+
+// masterKey is the passphrase protecting the stored passwords, once known.
+var masterKey string
+
+// getMasterKey returns the master key from ZEROS_KEY, prompting for it if
+// prompt is set. An empty key means passwords are stored in plaintext.
+func getMasterKey(prompt bool) (string, error) {
+	if masterKey != "" {
+		return masterKey, nil
+	}
+
+	masterKey = os.Getenv("ZEROS_KEY")
+	if masterKey == "" && prompt {
+		key, err := readPassword("Master key: ")
+		if err != nil {
+			return "", err
+		}
+		masterKey = key
+	}
+
+	return masterKey, nil
+}
+
+// deriveKey turns the master key into an AES-256 key.
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+// encryptSecret encrypts value with AES-GCM, returning it base64 encoded
+// behind encryptedPrefix. Values already encrypted are returned as is.
+func encryptSecret(passphrase, value string) (string, error) {
+	if value == "" || strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+
+	// Random salt and nonce, both stored in front of the ciphertext
+	salt := make([]byte, saltSize)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	data := append(salt, nonce...)
+	data = gcm.Seal(data, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// decryptSecret reverses encryptSecret. Values without encryptedPrefix are
+// plaintext and returned as is.
+func decryptSecret(passphrase, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %v", err)
+	}
+	if len(data) < saltSize {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+
+	gcm, err := newGCM(passphrase, data[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	data = data[saltSize:]
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("wrong master key or corrupted value")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptRepositories decrypts the secrets of every repository in place,
+// asking for the master key if some are encrypted.
+func decryptRepositories(config *Config) error {
+	for name, repo := range config.Repositories {
+		if !hasEncryptedSecrets(&repo) {
+			continue
+		}
+
+		key, err := getMasterKey(true)
+		if err != nil {
+			return fmt.Errorf("cannot get master key: %w", err)
+		}
+		err = decryptSecrets(key, &repo, fmt.Sprintf("repository '%s'", name))
+		if err != nil {
+			return err
+		}
+		config.Repositories[name] = repo
+	}
+
+	return nil
+}
+
+// hasEncryptedSecrets tells whether repo or its jump host has encrypted
+// secrets.
+func hasEncryptedSecrets(repo *Repository) bool {
+	if strings.HasPrefix(repo.Password, encryptedPrefix) || strings.HasPrefix(repo.Passphrase, encryptedPrefix) {
+		return true
+	}
+	return repo.Jump != nil && hasEncryptedSecrets(repo.Jump)
+}
+
+// decryptSecrets decrypts the secrets of repo and its jump host in place,
+// what naming repo in errors.
+func decryptSecrets(key string, repo *Repository, what string) error {
+	var err error
+	repo.Password, err = decryptSecret(key, repo.Password)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt password of %s: %w", what, err)
+	}
+	repo.Passphrase, err = decryptSecret(key, repo.Passphrase)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt passphrase of %s: %w", what, err)
+	}
+	if repo.Jump != nil {
+		jump := *repo.Jump
+		err = decryptSecrets(key, &jump, "the jump host of "+what)
+		if err != nil {
+			return err
+		}
+		repo.Jump = &jump
+	}
+	return nil
+}
+
+// encryptRepositories returns a copy of config with the secrets of every
+// repository encrypted, or config itself when no master key is available.
+func encryptRepositories(config *Config) (*Config, error) {
+	key, err := getMasterKey(false)
+	if err != nil || key == "" {
+		return config, err
+	}
+
+	encrypted := *config
+	encrypted.Repositories = make(map[string]Repository, len(config.Repositories))
+	for name, repo := range config.Repositories {
+		err = encryptSecrets(key, &repo)
+		if err != nil {
+			return nil, err
+		}
+		encrypted.Repositories[name] = repo
+	}
+
+	return &encrypted, nil
+}
+
+// encryptSecrets encrypts the secrets of repo and its jump host, leaving
+// the jump host of the caller untouched.
+func encryptSecrets(key string, repo *Repository) error {
+	var err error
+	repo.Password, err = encryptSecret(key, repo.Password)
+	if err != nil {
+		return err
+	}
+	repo.Passphrase, err = encryptSecret(key, repo.Passphrase)
+	if err != nil {
+		return err
+	}
+	if repo.Jump != nil {
+		jump := *repo.Jump
+		err = encryptSecrets(key, &jump)
+		if err != nil {
+			return err
+		}
+		repo.Jump = &jump
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// diffOp is a line of a diff: kept (' '), removed ('-') or added ('+').
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// splitLines splits data into lines without their line feed.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLines returns the shortest edit turning a into b, with Myers'
+// algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// Remember v before each round to walk the edit back
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		done := false
+		for k := -d; k <= d && !done; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			done = x >= n && y >= m
+		}
+		if done {
+			break
+		}
+	}
+
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+				y--
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+				x--
+			}
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// writeUnifiedDiff writes the differences between a and b in the unified
+// format. It writes nothing if they are the same.
+func writeUnifiedDiff(w io.Writer, fromName, toName string, a, b []byte) {
+	if bytes.Equal(a, b) {
+		return
+	}
+	if bytes.IndexByte(a, 0) >= 0 || bytes.IndexByte(b, 0) >= 0 {
+		fmt.Fprintf(w, "Binary files %s and %s differ\n", fromName, toName)
+		return
+	}
+
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	// Line numbers in a and b before each operation
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.kind != '+' {
+			aPos[i+1]++
+		}
+		if op.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; i < len(ops); {
+		// Skip to the next change
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// Grow the hunk over the changes close enough to share context
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for {
+			for end < len(ops) && ops[end].kind != ' ' {
+				end++
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next < len(ops) && next-end <= 2*diffContext {
+				end = next
+				continue
+			}
+			end += diffContext
+			if end > len(ops) {
+				end = len(ops)
+			}
+			break
+		}
+
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(aPos[start], aPos[end]), hunkRange(bPos[start], bPos[end]))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(w, "%c%s\n", op.kind, op.line)
+		}
+		i = end
+	}
+}
+
+// hunkRange formats the lines from start to end of a hunk header, starting
+// at 1 unless the range is empty.
+func hunkRange(start, end int) string {
+	count := end - start
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,61 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import "errors"
+
+// Exit codes of the program
+const (
+	exitOK         = 0   // success
+	exitUsage      = 1   // bad command line or arguments, and other errors
+	exitConfig     = 2   // configuration could not be read, saved or lacks an entry
+	exitConnection = 3   // repository could not be reached
+	exitTransfer   = 4   // file not found or transfer failure
+	exitInterrupt  = 130 // stopped by Ctrl-C or SIGTERM, as shells report SIGINT
+)
+
+// exitError is an error telling main which exit code to use.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+func usageError(err error) error {
+	return &exitError{code: exitUsage, err: err}
+}
+
+func configError(err error) error {
+	return &exitError{code: exitConfig, err: err}
+}
+
+func connectionError(err error) error {
+	return &exitError{code: exitConnection, err: err}
+}
+
+func transferError(err error) error {
+	return &exitError{code: exitTransfer, err: err}
+}
+
+// exitCode returns the exit code to use for err.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, errInterrupted) {
+		return exitInterrupt
+	}
+	var exitErr *exitError
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+	return exitUsage
+}
@@ -0,0 +1,98 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// TransferEvent is a file transfer, printed as a line of JSON with
+// --output json.
+type TransferEvent struct {
+	Action      string  `json:"action"`
+	Source      string  `json:"source"`
+	Destination string  `json:"destination"`
+	Bytes       int64   `json:"bytes"`
+	Duration    float64 `json:"duration"`
+	Status      string  `json:"status"`
+	Error       string  `json:"error,omitempty"`
+}
+
+var (
+	eventEncoder = json.NewEncoder(os.Stdout)
+	eventMutex   sync.Mutex
+)
+
+// jsonOutput tells whether transfers are reported as JSON lines.
+func jsonOutput() bool {
+	return *outputFlag == "json"
+}
+
+// checkOutput checks the format given by --output.
+func checkOutput() error {
+	switch *outputFlag {
+	case "text", "json":
+		return nil
+	}
+	return fmt.Errorf("invalid output format '%s', use text or json", *outputFlag)
+}
+
+// transferReport reports the outcome of the transfer of a file.
+type transferReport struct {
+	event TransferEvent
+	start time.Time
+}
+
+// startTransfer starts timing the transfer of source to destination, action
+// being download or upload.
+func startTransfer(action, source, destination string) *transferReport {
+	return &transferReport{
+		event: TransferEvent{Action: action, Source: source, Destination: destination},
+		start: time.Now(),
+	}
+}
+
+// done reports a successful transfer of bytes, with the text message of
+// format unless --output json was given.
+func (t *transferReport) done(bytes int64, format string, args ...any) {
+	transferredBytes.Add(bytes)
+	if !jsonOutput() {
+		infof(format, args...)
+		return
+	}
+	t.event.Bytes = bytes
+	t.event.Status = "ok"
+	t.write()
+}
+
+// fail reports a failed transfer with --output json, if err is set. Failures
+// are otherwise reported by the command as a whole.
+func (t *transferReport) fail(err error) {
+	if err == nil || !jsonOutput() {
+		return
+	}
+	t.event.Status = "failed"
+	t.event.Error = err.Error()
+	t.write()
+}
+
+func (t *transferReport) write() {
+	t.event.Duration = time.Since(t.start).Seconds()
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	eventEncoder.Encode(t.event)
+}
+
+// localSize returns the size of a local file, 0 if it cannot be read.
+func localSize(localPath string) int64 {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
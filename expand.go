@@ -0,0 +1,101 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// configPaths are the path settings of a repository as written in the
+// configuration, before expansion.
+type configPaths struct {
+	path            string
+	root            string
+	privateKey      string
+	credentialsFile string
+	downloadDir     string
+}
+
+// expandConfigPath expands the $VAR and ${VAR} of value, and a leading ~ if
+// home is set.
+func expandConfigPath(value, homeDir string) string {
+	value = os.ExpandEnv(value)
+	if homeDir == "" {
+		return value
+	}
+	return expandHome(value, homeDir)
+}
+
+// expandKeyList expands every file of a comma separated list of keys.
+func expandKeyList(value, homeDir string) string {
+	keyFiles := strings.Split(os.ExpandEnv(value), ",")
+	for i, keyFile := range keyFiles {
+		keyFiles[i] = expandHome(strings.TrimSpace(keyFile), homeDir)
+	}
+	return strings.Join(keyFiles, ",")
+}
+
+// expandRepositoryPaths expands the environment variables and ~ of the path
+// settings of repo and of its jump host, remembering them as written. The
+// path of remote repositories is on the server, where ~ is left to mean
+// what it does there.
+func expandRepositoryPaths(repo *Repository, homeDir string) {
+	repo.unexpanded = &configPaths{
+		path:            repo.Path,
+		root:            repo.Root,
+		privateKey:      repo.PrivateKey,
+		credentialsFile: repo.CredentialsFile,
+		downloadDir:     repo.DownloadDir,
+	}
+
+	if repo.Type == "local" || repo.Type == "network" {
+		repo.Path = expandConfigPath(repo.Path, homeDir)
+		repo.Root = expandConfigPath(repo.Root, homeDir)
+	} else {
+		repo.Path = expandConfigPath(repo.Path, "")
+		repo.Root = expandConfigPath(repo.Root, "")
+	}
+	repo.PrivateKey = expandKeyList(repo.PrivateKey, homeDir)
+	repo.CredentialsFile = expandConfigPath(repo.CredentialsFile, homeDir)
+	repo.DownloadDir = expandConfigPath(repo.DownloadDir, homeDir)
+
+	if repo.Jump != nil {
+		jump := *repo.Jump
+		expandRepositoryPaths(&jump, homeDir)
+		repo.Jump = &jump
+	}
+}
+
+// unexpandRepositoryPaths puts back the path settings of repo and of its
+// jump host as they were written, unless they were changed since.
+func unexpandRepositoryPaths(repo *Repository, homeDir string) {
+	if raw := repo.unexpanded; raw != nil {
+		restore := func(value *string, written string, expand func(string, string) string) {
+			if *value == expand(written, homeDir) {
+				*value = written
+			}
+		}
+		if repo.Type == "local" || repo.Type == "network" {
+			restore(&repo.Path, raw.path, expandConfigPath)
+			restore(&repo.Root, raw.root, expandConfigPath)
+		} else {
+			if repo.Path == expandConfigPath(raw.path, "") {
+				repo.Path = raw.path
+			}
+			if repo.Root == expandConfigPath(raw.root, "") {
+				repo.Root = raw.root
+			}
+		}
+		restore(&repo.PrivateKey, raw.privateKey, expandKeyList)
+		restore(&repo.CredentialsFile, raw.credentialsFile, expandConfigPath)
+		restore(&repo.DownloadDir, raw.downloadDir, expandConfigPath)
+	}
+
+	if repo.Jump != nil {
+		jump := *repo.Jump
+		unexpandRepositoryPaths(&jump, homeDir)
+		repo.Jump = &jump
+	}
+}
@@ -0,0 +1,112 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// exportConfig writes the configuration to file, or to stdout if file is -,
+// as it is saved: paths as written, with ~ or variables, and passwords
+// encrypted if a master key is available. --no-secrets leaves the secrets
+// out.
+func exportConfig(config *Config, file string) error {
+	exported := *config
+	if *noSecretsFlag {
+		exported.Repositories = make(map[string]Repository, len(config.Repositories))
+		for name, repo := range config.Repositories {
+			stripSecrets(&repo)
+			exported.Repositories[name] = repo
+		}
+	}
+
+	byteValue, err := marshalConfig(&exported)
+	if err != nil {
+		return configError(fmt.Errorf("cannot export configuration: %w", err))
+	}
+
+	if file == "-" {
+		_, err = os.Stdout.Write(append(byteValue, '\n'))
+		return err
+	}
+	err = ioutil.WriteFile(file, byteValue, 0600)
+	if err != nil {
+		return configError(fmt.Errorf("cannot export configuration: %w", err))
+	}
+	infof("Exported %d repositories to '%s'\n", len(exported.Repositories), file)
+	return nil
+}
+
+// stripSecrets removes the passwords, passphrases, keys of cloud accounts
+// and proxy passwords of repo and its jump host. Passwords read from a file
+// or a command are kept, they hold no secret themselves.
+func stripSecrets(repo *Repository) {
+	if !strings.HasPrefix(repo.Password, "file:") && !strings.HasPrefix(repo.Password, "cmd:") {
+		repo.Password = ""
+	}
+	repo.Passphrase = ""
+	repo.SecretKey = ""
+	repo.AccountKey = ""
+	if proxyURL, err := url.Parse(repo.Proxy); err == nil && proxyURL.User != nil {
+		proxyURL.User = url.User(proxyURL.User.Username())
+		repo.Proxy = proxyURL.String()
+	}
+
+	if repo.Jump != nil {
+		jump := *repo.Jump
+		stripSecrets(&jump)
+		repo.Jump = &jump
+	}
+}
+
+// importConfig adds the repositories of the configuration file to config.
+// Those named as existing ones are skipped, unless --overwrite is given.
+func importConfig(config *Config, file string) error {
+	byteValue, err := ioutil.ReadFile(file)
+	if err != nil {
+		return configError(fmt.Errorf("cannot read configuration to import: %w", err))
+	}
+	imported, err := parseConfig(byteValue)
+	if err != nil {
+		return configError(fmt.Errorf("cannot import '%s': %w", file, err))
+	}
+
+	var names []string
+	for name := range imported.Repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	added, skipped := 0, 0
+	for _, name := range names {
+		if _, exists := config.Repositories[name]; exists && !*overwriteFlag {
+			fmt.Fprintf(os.Stderr, "Warning: skipping repository '%s', already configured (use --overwrite to replace it)\n", name)
+			skipped++
+			continue
+		}
+		config.Repositories[name] = imported.Repositories[name]
+		added++
+	}
+
+	// A configuration without a current repository takes the imported one
+	if _, ok := config.Repositories[config.Current]; !ok {
+		if _, ok := imported.Repositories[imported.Current]; ok {
+			config.Current = imported.Current
+		}
+	}
+
+	if added > 0 {
+		err = saveConfig(config)
+		if err != nil {
+			return configError(fmt.Errorf("cannot save configuration: %w", err))
+		}
+	}
+	infof("Imported %d repositories, %d skipped\n", added, skipped)
+	return nil
+}
@@ -0,0 +1,227 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// patternsFlag is a flag that may be repeated, collecting glob patterns.
+type patternsFlag []string
+
+var (
+	includeFlag patternsFlag
+	excludeFlag patternsFlag
+)
+
+// sinceTime is the modification time given by --since, files older than it
+// are skipped. Zero when no --since was given.
+var sinceTime time.Time
+
+// minSize and maxSize are the sizes given by --min-size and --max-size, -1
+// when not given.
+var minSize, maxSize int64 = -1, -1
+
+func (p *patternsFlag) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternsFlag) Set(value string) error {
+	_, err := path.Match(value, "")
+	if err != nil {
+		return err
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// skipEntry tells whether the entry at relPath, relative to the repository
+// directory, is left out of directory transfers by --exclude and --include.
+// Excludes are checked first. Includes only select files, directories are
+// still walked to find them.
+func skipEntry(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(relPath)
+	for _, pattern := range excludeFlag {
+		// A trailing slash only selects directories
+		if strings.HasSuffix(pattern, "/") {
+			if isDir && matchPattern(strings.TrimSuffix(pattern, "/"), relPath) {
+				return true
+			}
+			continue
+		}
+		if matchPattern(pattern, relPath) {
+			return true
+		}
+	}
+
+	if isDir || len(includeFlag) == 0 {
+		return false
+	}
+	for _, pattern := range includeFlag {
+		if matchPattern(pattern, relPath) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPattern matches pattern against the whole relative path, or against
+// its last element when pattern has no slash, so that node_modules or *.csv
+// match at any depth. A leading slash anchors pattern to the repository
+// directory.
+func matchPattern(pattern, relPath string) bool {
+	if strings.HasPrefix(pattern, "/") {
+		pattern = pattern[1:]
+	} else if !strings.Contains(pattern, "/") {
+		relPath = path.Base(relPath)
+	}
+	matched, _ := path.Match(pattern, relPath)
+	return matched
+}
+
+// relativePath returns itemPath relative to the slash separated root, for
+// remote paths.
+func relativePath(root, itemPath string) string {
+	root = path.Clean(filepath.ToSlash(root))
+	if root == "." {
+		return strings.TrimPrefix(itemPath, "./")
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(itemPath, root), "/")
+}
+
+// loadExcludeFrom adds the patterns of the file given by --exclude-from to
+// the excludes. The file is read as a .gitignore, one pattern per line with
+// # starting comments, except that negated patterns are not supported.
+func loadExcludeFrom() error {
+	if *ignoreFlag == "" {
+		return nil
+	}
+
+	file, err := os.Open(*ignoreFlag)
+	if err != nil {
+		return fmt.Errorf("cannot read exclude file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimRight(scanner.Text(), " \t\r")
+		switch {
+		case pattern == "" || strings.HasPrefix(pattern, "#"):
+			continue
+		case strings.HasPrefix(pattern, "!"):
+			return fmt.Errorf("%s:%d: negated patterns are not supported", *ignoreFlag, line)
+		case strings.HasPrefix(pattern, "\\#"), strings.HasPrefix(pattern, "\\!"):
+			pattern = pattern[1:]
+		}
+
+		// Leading **/ matches at any depth, as patterns without slash do
+		if rest := strings.TrimPrefix(pattern, "**/"); rest != pattern && !strings.Contains(strings.TrimSuffix(rest, "/"), "/") {
+			pattern = rest
+		}
+
+		_, err := path.Match(strings.Trim(pattern, "/"), "")
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", *ignoreFlag, line, err)
+		}
+		excludeFlag = append(excludeFlag, pattern)
+	}
+	return scanner.Err()
+}
+
+// sinceLayouts are the date formats accepted by --since, in local time.
+var sinceLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// setFileFilters sets the time and sizes given by --since, --min-size and
+// --max-size.
+func setFileFilters() error {
+	err := setSince()
+	if err != nil {
+		return err
+	}
+
+	minSize, maxSize = -1, -1
+	if *minSizeFlag != "" {
+		minSize, err = parseSize(*minSizeFlag)
+		if err != nil {
+			return fmt.Errorf("--min-size: %w", err)
+		}
+	}
+	if *maxSizeFlag != "" {
+		maxSize, err = parseSize(*maxSizeFlag)
+		if err != nil {
+			return fmt.Errorf("--max-size: %w", err)
+		}
+	}
+	if minSize >= 0 && maxSize >= 0 && minSize > maxSize {
+		return fmt.Errorf("--min-size %s is larger than --max-size %s", *minSizeFlag, *maxSizeFlag)
+	}
+	return nil
+}
+
+// setSince sets the time given by --since, either a duration back from now
+// such as 24h, 90m or 7d, or a date such as 2025-01-01 or 2025-01-01 12:00.
+func setSince() error {
+	sinceTime = time.Time{}
+	value := strings.TrimSpace(*sinceFlag)
+	if value == "" {
+		return nil
+	}
+
+	// Durations have no unit for days
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.ParseFloat(days, 64)
+		if err == nil && n >= 0 {
+			sinceTime = time.Now().Add(-time.Duration(n * float64(24*time.Hour)))
+			return nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration >= 0 {
+		sinceTime = time.Now().Add(-duration)
+		return nil
+	}
+	for _, layout := range sinceLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			sinceTime = date
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time '%s' for --since, use a duration such as 24h or 7d, or a date such as 2025-01-01", *sinceFlag)
+}
+
+// skipFile tells whether the file at itemPath is left out by --since,
+// --min-size or --max-size, saying why when verbose. Directories are always
+// walked, they may hold files that are not.
+func skipFile(itemPath string, info os.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+
+	var reason string
+	switch {
+	case !sinceTime.IsZero() && info.ModTime().Before(sinceTime):
+		reason = "modified before --since"
+	case minSize >= 0 && info.Size() < minSize:
+		reason = "smaller than --min-size"
+	case maxSize >= 0 && info.Size() > maxSize:
+		reason = "larger than --max-size"
+	default:
+		return false
+	}
+	logf(logVerbose, "Skipping '%s', %s\n", itemPath, reason)
+	return true
+}
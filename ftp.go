@@ -0,0 +1,238 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jlaffaye/ftp"
+)
+
+func getFTPClient(repo *Repository) (*ftp.ServerConn, error) {
+	resolved := *repo
+	normalizeHost(&resolved)
+	repo = &resolved
+
+	port := repo.Port
+	if port == 0 {
+		port = 21
+	}
+
+	// Connect to FTP server
+	logf(logVerbose, "Connecting to '%s'\n", net.JoinHostPort(repo.Host, fmt.Sprint(port)))
+	client, err := ftp.Dial(net.JoinHostPort(repo.Host, fmt.Sprint(port)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Log in, anonymously if no user is configured
+	user, password := repo.User, repo.Password
+	if user == "" {
+		user, password = "anonymous", "anonymous"
+	} else {
+		password, err = resolvePassword(password)
+		if err != nil {
+			client.Quit()
+			return nil, err
+		}
+	}
+	err = client.Login(user, password)
+	if err != nil {
+		client.Quit()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// ftpPath joins name to the path of an FTP repository.
+func ftpPath(repo *Repository, name string) string {
+	return path.Join(repo.Path, filepath.ToSlash(name))
+}
+
+func listFTPDirectory(client *ftp.ServerConn, remotePath string) ([]os.FileInfo, error) {
+	entries, err := client.List(remotePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []os.FileInfo
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		files = append(files, ftpEntryInfo(entry))
+	}
+
+	return files, nil
+}
+
+func ftpEntryInfo(entry *ftp.Entry) os.FileInfo {
+	return objectInfo{
+		name:    entry.Name,
+		size:    int64(entry.Size),
+		modTime: entry.Time,
+		dir:     entry.Type == ftp.EntryTypeFolder,
+	}
+}
+
+// isFTPDirectory tells whether remotePath is a directory, by trying to
+// change to it and coming back.
+func isFTPDirectory(client *ftp.ServerConn, remotePath string) bool {
+	currentDir, err := client.CurrentDir()
+	if err != nil {
+		return false
+	}
+	if client.ChangeDir(remotePath) != nil {
+		return false
+	}
+	client.ChangeDir(currentDir)
+	return true
+}
+
+func downloadFTPFile(client *ftp.ServerConn, remotePath, localPath string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would download '%s' to '%s'\n", remotePath, localPath)
+		return nil
+	}
+
+	logf(logVerbose, "Downloading '%s' to '%s'\n", remotePath, localPath)
+	report := startTransfer("download", remotePath, localPath)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Open remote file
+	response, err := client.Retr(remotePath)
+	if err != nil {
+		return fmt.Errorf("could not open remote file: %v", err)
+	}
+	defer response.Close()
+
+	// Copy contents to the local file
+	err = writeLocalFile(localPath, response, nil)
+	if err != nil {
+		return fmt.Errorf("could not write local file: %v", err)
+	}
+
+	report.done(localSize(localPath), "Downloaded file '%s'\n", remotePath)
+	return nil
+}
+
+func downloadFTPDirectory(client *ftp.ServerConn, remotePath, localPath string) error {
+	// Create local directory
+	err := makeLocalDirectory(localPath)
+	if err != nil {
+		return err
+	}
+
+	// Collect remote directory contents first, the control connection
+	// can't list and transfer at the same time
+	var jobs []transferJob
+	walker := client.Walk(remotePath)
+	for walker.Next() {
+		if walker.Err() != nil {
+			return fmt.Errorf("error walking remote directory: %v", walker.Err())
+		}
+
+		relPath := strings.TrimPrefix(walker.Path(), strings.TrimSuffix(remotePath, "/"))
+		if relPath == "" || relPath == "/" {
+			continue
+		}
+
+		localItemPath := filepath.Join(localPath, filepath.FromSlash(relPath))
+		if walker.Stat().Type == ftp.EntryTypeFolder {
+			err = makeLocalDirectory(localItemPath)
+			if err != nil {
+				return err
+			}
+		} else if !skipFile(walker.Path(), ftpEntryInfo(walker.Stat())) {
+			jobs = append(jobs, transferJob{remotePath: walker.Path(), localPath: localItemPath})
+		}
+	}
+
+	for _, job := range jobs {
+		err = downloadFTPFile(client, job.remotePath, job.localPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uploadFTPFile(client *ftp.ServerConn, localPath, remotePath string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would upload '%s' to '%s'\n", localPath, remotePath)
+		return nil
+	}
+
+	logf(logVerbose, "Uploading '%s' to '%s'\n", localPath, remotePath)
+	report := startTransfer("upload", localPath, remotePath)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Open local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("could not open local file: %v", err)
+	}
+	defer localFile.Close()
+
+	// Store remote file
+	err = client.Stor(remotePath, limitReader(localFile))
+	if err != nil {
+		// FTP writes in place, leave no partial file behind when stopped
+		if stopped := operationErr(); stopped != nil {
+			client.Delete(remotePath)
+			return fmt.Errorf("could not store remote file: %w", stopped)
+		}
+		return fmt.Errorf("could not store remote file: %v", err)
+	}
+
+	report.done(localSize(localPath), "Uploaded file '%s'\n", localPath)
+	return nil
+}
+
+func uploadFTPDirectory(client *ftp.ServerConn, localPath, remotePath string) error {
+	// Walk local directory contents
+	return filepath.Walk(localPath, func(localItemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking local directory: %v", err)
+		}
+
+		relPath, err := filepath.Rel(localPath, localItemPath)
+		if err != nil {
+			return err
+		}
+		remoteItemPath := path.Join(remotePath, filepath.ToSlash(relPath))
+
+		if info.IsDir() {
+			if *dryRunFlag {
+				fmt.Printf("Would create directory '%s'\n", remoteItemPath)
+				return nil
+			}
+
+			// The directory may already exist, which is fine
+			if !isFTPDirectory(client, remoteItemPath) {
+				err = client.MakeDir(remoteItemPath)
+				if err != nil {
+					return fmt.Errorf("could not create remote directory: %v", err)
+				}
+				infof("Created directory '%s'\n", remoteItemPath)
+			}
+			return nil
+		}
+
+		if skipFile(localItemPath, info) {
+			return nil
+		}
+		return uploadFTPFile(client, localItemPath, remoteItemPath)
+	})
+}
@@ -0,0 +1,209 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+func getGCSClient(repo *Repository) (*storage.Client, error) {
+	var options []option.ClientOption
+	// Use the configured service account, otherwise the application default
+	// credentials
+	if repo.CredentialsFile != "" {
+		options = append(options, option.WithCredentialsFile(repo.CredentialsFile))
+	}
+	if repo.Endpoint != "" {
+		options = append(options, option.WithEndpoint(repo.Endpoint))
+	}
+
+	return storage.NewClient(operation, options...)
+}
+
+func listGCSDirectory(client *storage.Client, bucket, key string) ([]os.FileInfo, error) {
+	prefix := dirPrefix(key)
+	var files []os.FileInfo
+
+	it := client.Bucket(bucket).Objects(operation, &storage.Query{
+		Prefix:    prefix,
+		Delimiter: "/",
+	})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Prefixes stand for directories
+		if attrs.Prefix != "" {
+			name := strings.TrimSuffix(strings.TrimPrefix(attrs.Prefix, prefix), "/")
+			files = append(files, objectInfo{name: name, dir: true})
+			continue
+		}
+		name := strings.TrimPrefix(attrs.Name, prefix)
+		if name == "" {
+			continue
+		}
+		files = append(files, objectInfo{
+			name:    name,
+			size:    attrs.Size,
+			modTime: attrs.Updated,
+		})
+	}
+
+	return files, nil
+}
+
+// isGCSDirectory tells whether key is a prefix holding other objects.
+func isGCSDirectory(client *storage.Client, bucket, key string) (bool, error) {
+	it := client.Bucket(bucket).Objects(operation, &storage.Query{
+		Prefix: dirPrefix(key),
+	})
+	_, err := it.Next()
+	if err == iterator.Done {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func downloadGCSObject(client *storage.Client, bucket, key, localPath string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would download 'gs://%s/%s' to '%s'\n", bucket, key, localPath)
+		return nil
+	}
+
+	logf(logVerbose, "Downloading 'gs://%s/%s' to '%s'\n", bucket, key, localPath)
+	report := startTransfer("download", "gs://"+bucket+"/"+key, localPath)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Get remote object
+	reader, err := client.Bucket(bucket).Object(key).NewReader(operation)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("object '%s' does not exist", key)
+		}
+		return fmt.Errorf("could not get object: %v", err)
+	}
+	defer reader.Close()
+
+	// Copy contents to the local file
+	err = writeLocalFile(localPath, reader, nil)
+	if err != nil {
+		return fmt.Errorf("could not write local file: %v", err)
+	}
+
+	report.done(localSize(localPath), "Downloaded object '%s'\n", key)
+	return nil
+}
+
+func downloadGCSDirectory(client *storage.Client, bucket, key, localPath string) error {
+	prefix := dirPrefix(key)
+
+	it := client.Bucket(bucket).Objects(operation, &storage.Query{
+		Prefix: prefix,
+	})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error listing objects: %v", err)
+		}
+
+		relPath := strings.TrimPrefix(attrs.Name, prefix)
+		if relPath == "" || strings.HasSuffix(relPath, "/") {
+			continue
+		}
+
+		localItemPath := filepath.Join(localPath, filepath.FromSlash(relPath))
+		err = makeLocalDirectory(filepath.Dir(localItemPath))
+		if err != nil {
+			return err
+		}
+
+		err = downloadGCSObject(client, bucket, attrs.Name, localItemPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func uploadGCSObject(client *storage.Client, bucket, localPath, key string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would upload '%s' to 'gs://%s/%s'\n", localPath, bucket, key)
+		return nil
+	}
+
+	logf(logVerbose, "Uploading '%s' to 'gs://%s/%s'\n", localPath, bucket, key)
+	report := startTransfer("upload", localPath, "gs://"+bucket+"/"+key)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Open local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("could not open local file: %v", err)
+	}
+	defer localFile.Close()
+
+	// Stream to the remote object, which is only created once the writer
+	// is closed. Cancelling the context aborts it instead.
+	ctx, cancel := context.WithCancel(operation)
+	defer cancel()
+	writer := client.Bucket(bucket).Object(key).NewWriter(ctx)
+	_, err = io.Copy(writer, limitReader(localFile))
+	if err != nil {
+		cancel()
+		writer.Close()
+		return fmt.Errorf("could not copy file contents: %v", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("could not put object: %v", err)
+	}
+
+	report.done(localSize(localPath), "Uploaded file '%s'\n", localPath)
+	return nil
+}
+
+func uploadGCSDirectory(client *storage.Client, bucket, localPath, key string) error {
+	// Walk local directory contents, object stores have no real directories
+	return filepath.Walk(localPath, func(localItemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking local directory: %v", err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(localPath, localItemPath)
+		if err != nil {
+			return err
+		}
+
+		return uploadGCSObject(client, bucket, localItemPath, objectKey(key, relPath))
+	})
+}
@@ -0,0 +1,155 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// grepMaxLine is the longest line grep scans, files with longer ones are
+// skipped with a warning.
+const grepMaxLine = 1024 * 1024
+
+// grepRepository prints the lines of the files of the current repository,
+// below name if given, matching the regular expression pattern, as
+// path:line:text. Files are read line by line, over SFTP for SSH, and never
+// stored locally. --include and --exclude limit the files scanned.
+func grepRepository(config *Config, pattern, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	if *noCaseFlag {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return usageError(fmt.Errorf("invalid pattern: %w", err))
+	}
+
+	// Get target path, making sure it stays inside the repository
+	targetPath, err := resolvePath(&repo, name)
+	if err != nil {
+		return usageError(err)
+	}
+
+	switch repo.Type {
+	case "local", "network":
+		if useSMB(&repo) {
+			return usageError(fmt.Errorf("'grep' not implemented yet for shares reached over SMB"))
+		}
+		err = filepath.Walk(targetPath, func(itemPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := operationErr(); err != nil {
+				return err
+			}
+			relPath := relativePath(repo.Path, filepath.ToSlash(itemPath))
+			if itemPath != targetPath && skipEntry(relPath, info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			file, err := os.Open(itemPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: skipping '%s': %v\n", relPath, err)
+				return nil
+			}
+			defer file.Close()
+			grepFile(re, relPath, file)
+			return nil
+		})
+		if err != nil {
+			return transferError(fmt.Errorf("cannot walk repository: %w", err))
+		}
+	case "ssh":
+		targetPath = filepath.ToSlash(targetPath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		walker := sftp.Walk(targetPath)
+		for walker.Step() {
+			if walker.Err() != nil {
+				return transferError(fmt.Errorf("cannot walk remote directory: %w", walker.Err()))
+			}
+			if err := operationErr(); err != nil {
+				return transferError(err)
+			}
+			info := walker.Stat()
+			relPath := relativePath(repo.Path, walker.Path())
+			if walker.Path() != targetPath && skipEntry(relPath, info.IsDir()) {
+				if info.IsDir() {
+					walker.SkipDir()
+				}
+				continue
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+
+			file, err := sftp.Open(walker.Path())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: skipping '%s': %v\n", relPath, err)
+				continue
+			}
+			grepFile(re, relPath, file)
+			file.Close()
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'grep'", repo.Type))
+	}
+
+	return nil
+}
+
+// grepFile prints the lines of r matching re, prefixed with relPath and
+// their number. A binary file, holding a NUL byte, is only reported as
+// matching.
+func grepFile(re *regexp.Regexp, relPath string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), grepMaxLine)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Bytes()
+		if !re.Match(line) {
+			continue
+		}
+		if bytes.IndexByte(line, 0) >= 0 {
+			fmt.Printf("Binary file %s matches\n", relPath)
+			return
+		}
+		fmt.Printf("%s:%d:%s\n", relPath, lineNumber, strings.TrimSuffix(string(line), "\r"))
+	}
+
+	err := scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		fmt.Fprintf(os.Stderr, "Warning: skipping the rest of '%s', a line is longer than %s\n", relPath, humanizeBytes(grepMaxLine))
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot read '%s': %v\n", relPath, err)
+	}
+}
@@ -0,0 +1,202 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+// SSH itself could compress the whole connection, but the Go SSH library
+// offers no compression. Files are instead streamed through gzip running on
+// the server when --gzip is given or the repository sets compress. It pays
+// off for text, logs or databases over slow links, and wastes CPU on both
+// ends for data that is already compressed (archives, images, videos). It
+// needs gzip on the server and a shell to run it, and such transfers can be
+// neither resumed nor shown with a progress bar.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/melbahja/goph"
+	"github.com/pkg/sftp"
+)
+
+// useGzip tells whether SSH transfers to repo go through gzip streams.
+func useGzip(repo *Repository) bool {
+	return *gzipFlag || repo.Compress
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteCommandError adds what the remote command wrote on stderr to err.
+func remoteCommandError(err error, stderr *bytes.Buffer) error {
+	message := strings.TrimSpace(stderr.String())
+	if message == "" {
+		return err
+	}
+	return fmt.Errorf("%v: %s", err, message)
+}
+
+func downloadGzipFile(client *goph.Client, sftp *sftp.Client, remotePath, localPath string) error {
+	report := startTransfer("download", remotePath, localPath)
+	err := retry(fmt.Sprintf("Download of '%s'", remotePath), func() error {
+		return tryDownloadGzipFile(client, sftp, remotePath, localPath, report)
+	})
+	report.fail(err)
+	return err
+}
+
+// tryDownloadGzipFile downloads remotePath compressed by gzip on the server
+// and decompressed on the fly.
+func tryDownloadGzipFile(client *goph.Client, sftp *sftp.Client, remotePath, localPath string, report *transferReport) error {
+	if *dryRunFlag {
+		fmt.Printf("Would download '%s' to '%s' with gzip\n", remotePath, localPath)
+		return nil
+	}
+
+	logf(logVerbose, "Downloading '%s' to '%s' with gzip\n", remotePath, localPath)
+
+	remoteStat, err := sftp.Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("could not get remote file info: %v", err)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("could not open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("could not open SSH session: %w", err)
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	err = session.Start("gzip -c < " + shellQuote(remotePath))
+	if err != nil {
+		return fmt.Errorf("could not run gzip on the server: %w", err)
+	}
+
+	// The stream is empty if gzip could not start
+	reader, err := gzip.NewReader(stdout)
+	if err != nil {
+		if waitErr := session.Wait(); waitErr != nil {
+			return fmt.Errorf("could not run gzip on the server: %v", remoteCommandError(waitErr, &stderr))
+		}
+		return fmt.Errorf("could not read compressed stream: %w", err)
+	}
+
+	err = writeLocalFile(localPath, reader, remoteStat)
+	if err != nil {
+		session.Wait()
+		return fmt.Errorf("could not copy file contents: %w", err)
+	}
+	err = session.Wait()
+	if err != nil {
+		return fmt.Errorf("gzip failed on the server: %v", remoteCommandError(err, &stderr))
+	}
+
+	report.done(remoteStat.Size(), "Downloaded file '%s'\n", remotePath)
+	return nil
+}
+
+func uploadGzipFile(client *goph.Client, sftp *sftp.Client, localPath, remotePath string) error {
+	report := startTransfer("upload", localPath, remotePath)
+	err := retry(fmt.Sprintf("Upload of '%s'", localPath), func() error {
+		return retryMismatch(func() error {
+			return tryUploadGzipFile(client, sftp, localPath, remotePath, report)
+		})
+	})
+	report.fail(err)
+	return err
+}
+
+// tryUploadGzipFile uploads localPath compressed on the fly and decompressed
+// by gzip on the server.
+func tryUploadGzipFile(client *goph.Client, sftp *sftp.Client, localPath, remotePath string, report *transferReport) error {
+	if *dryRunFlag {
+		fmt.Printf("Would upload '%s' to '%s' with gzip\n", localPath, remotePath)
+		return nil
+	}
+
+	logf(logVerbose, "Uploading '%s' to '%s' with gzip\n", localPath, remotePath)
+
+	// Open local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("could not open local file: %v", err)
+	}
+	defer localFile.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("could not open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("could not open SSH session: %w", err)
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	// Decompress to a temporary file, renamed into place once complete
+	tmpPath := tempPath(remotePath)
+	err = session.Start("gzip -dc > " + shellQuote(tmpPath))
+	if err != nil {
+		return fmt.Errorf("could not run gzip on the server: %w", err)
+	}
+	complete := false
+	defer func() {
+		if !complete {
+			sftp.Remove(tmpPath)
+		}
+	}()
+
+	writer := gzip.NewWriter(stdin)
+	_, err = io.Copy(writer, limitReader(localFile))
+	if err == nil {
+		err = writer.Close()
+	}
+	stdin.Close()
+	waitErr := session.Wait()
+	if waitErr != nil {
+		return fmt.Errorf("gzip failed on the server: %v", remoteCommandError(waitErr, &stderr))
+	}
+	if err != nil {
+		return fmt.Errorf("could not copy file contents: %w", err)
+	}
+
+	localStat, err := localFile.Stat()
+	if err != nil {
+		return fmt.Errorf("could not get local file info: %v", err)
+	}
+
+	// Check what arrived before it replaces the remote file
+	err = verifyUpload(sftp, localPath, tmpPath, localStat.Size())
+	if err != nil {
+		return err
+	}
+
+	err = preserveRemote(sftp, tmpPath, localStat)
+	if err != nil {
+		return err
+	}
+
+	err = renameRemote(sftp, tmpPath, remotePath)
+	if err != nil {
+		return err
+	}
+	complete = true
+
+	report.done(localStat.Size(), "Uploaded file '%s'\n", localPath)
+	return nil
+}
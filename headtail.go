@@ -0,0 +1,256 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tailChunkSize is the size of the blocks read backward from the end of a
+// file by tail.
+const tailChunkSize = 8192
+
+func headRepository(config *Config, name string) error {
+	return readRepositoryFile(config, name, "head", func(r io.ReadSeeker, size int64) error {
+		return writeHead(os.Stdout, r, *linesFlag)
+	})
+}
+
+func tailRepository(config *Config, name string) error {
+	if *followLogFlag {
+		return followRepository(config, name)
+	}
+	return readRepositoryFile(config, name, "tail", func(r io.ReadSeeker, size int64) error {
+		return writeTail(os.Stdout, r, size, *linesFlag)
+	})
+}
+
+// writeHead writes the first n lines of r to w, reading no further.
+func writeHead(w io.Writer, r io.Reader, n int) error {
+	reader := bufio.NewReader(r)
+	for i := 0; i < n; i++ {
+		line, err := reader.ReadBytes('\n')
+		if _, werr := w.Write(line); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTail writes the last n lines of r, of the given size, to w. It reads
+// backward from the end in chunks until it has seen enough line feeds, so
+// that only the end of big files is read.
+func writeTail(w io.Writer, r io.ReadSeeker, size int64, n int) error {
+	if n == 0 {
+		return nil
+	}
+
+	// The line feed ending the last line does not start a new one
+	start := size
+	found := 0
+	chunk := make([]byte, tailChunkSize)
+	skipLast := true
+	for start > 0 && found <= n {
+		length := int64(tailChunkSize)
+		if start < length {
+			length = start
+		}
+		start -= length
+
+		_, err := r.Seek(start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(r, chunk[:length])
+		if err != nil {
+			return err
+		}
+
+		for i := length - 1; i >= 0; i-- {
+			if chunk[i] != '\n' {
+				skipLast = false
+				continue
+			}
+			if skipLast {
+				skipLast = false
+				continue
+			}
+			found++
+			if found == n {
+				// The lines wanted start right after this line feed
+				start += i + 1
+				break
+			}
+		}
+		if found == n {
+			break
+		}
+	}
+
+	_, err := r.Seek(start, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, io.LimitReader(r, size-start))
+	return err
+}
+
+// tailPollInterval is the time between two checks for new data with tail -f.
+const tailPollInterval = time.Second
+
+// followedFile is a file opened by tail -f.
+type followedFile interface {
+	io.ReadSeekCloser
+	Stat() (os.FileInfo, error)
+}
+
+// followSource reaches the file followed by tail -f, by path so that it can
+// be reopened when rotated.
+type followSource struct {
+	stat func() (os.FileInfo, error)
+	open func() (followedFile, error)
+
+	// sameFile tells whether the path, stat just before, still leads to
+	// the open file
+	sameFile func(file, path os.FileInfo) bool
+}
+
+// followRepository prints the last lines of the repository file name, then
+// the data appended to it until interrupted.
+func followRepository(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get file path, making sure it stays inside the repository
+	filePath, err := resolvePath(&repo, name)
+	if err != nil {
+		return usageError(err)
+	}
+
+	var source followSource
+	switch repo.Type {
+	case "local", "network":
+		source = followSource{
+			stat: func() (os.FileInfo, error) {
+				return os.Stat(filePath)
+			},
+			open: func() (followedFile, error) {
+				return os.Open(filePath)
+			},
+			sameFile: os.SameFile,
+		}
+	case "ssh":
+		filePath = filepath.ToSlash(filePath)
+
+		// Get SSH client
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		source = followSource{
+			stat: func() (os.FileInfo, error) {
+				return sftp.Stat(filePath)
+			},
+			open: func() (followedFile, error) {
+				return sftp.Open(filePath)
+			},
+			sameFile: func(file, path os.FileInfo) bool {
+				// SFTP tells no inodes, but the open file can only have
+				// grown since the path was stat if they are the same
+				return file.Size() >= path.Size()
+			},
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'tail'", repo.Type))
+	}
+
+	return followFile(os.Stdout, filePath, source, *linesFlag)
+}
+
+// followFile writes the last n lines of the file of source to w, then polls
+// it for appended data. A file that shrinks or is replaced, e.g. by log
+// rotation, is reopened and printed from its start.
+func followFile(w io.Writer, filePath string, source followSource, n int) error {
+	info, err := source.stat()
+	if err != nil {
+		return transferError(fmt.Errorf("cannot access path '%s': %w", filePath, err))
+	}
+	if info.IsDir() {
+		return transferError(fmt.Errorf("'%s' is a directory", filePath))
+	}
+	file, err := source.open()
+	if err != nil {
+		return transferError(fmt.Errorf("cannot open file: %w", err))
+	}
+	defer func() {
+		file.Close()
+	}()
+
+	err = writeTail(w, file, info.Size(), n)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot read file: %w", err))
+	}
+	offset := info.Size()
+
+	for {
+		// Ctrl-C or --deadline is the normal end of tail -f
+		select {
+		case <-time.After(tailPollInterval):
+		case <-operation.Done():
+			return nil
+		}
+
+		// The file may be missing for a moment while rotated
+		current, err := source.stat()
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return transferError(fmt.Errorf("cannot access path '%s': %w", filePath, err))
+		}
+
+		opened, err := file.Stat()
+		if err != nil {
+			return transferError(fmt.Errorf("cannot access path '%s': %w", filePath, err))
+		}
+
+		if !source.sameFile(opened, current) || current.Size() < offset {
+			logf(logInfo, "'%s' was truncated or replaced, reopening\n", filePath)
+			file.Close()
+			file, err = source.open()
+			if err != nil {
+				return transferError(fmt.Errorf("cannot open file: %w", err))
+			}
+			offset = 0
+		}
+
+		if current.Size() > offset {
+			_, err = file.Seek(offset, io.SeekStart)
+			if err == nil {
+				_, err = io.CopyN(w, file, current.Size()-offset)
+			}
+			if err != nil {
+				return transferError(fmt.Errorf("cannot read file: %w", err))
+			}
+			offset = current.Size()
+		}
+	}
+}
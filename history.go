@@ -0,0 +1,140 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// historyEntry is a get, put or rm, kept as a line of JSON in the history
+// file.
+type historyEntry struct {
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"`
+	Repository string    `json:"repository"`
+	Path       string    `json:"path"`
+	Bytes      int64     `json:"bytes"`
+	Result     string    `json:"result"`
+}
+
+// transferredBytes counts the bytes of the files transferred by the running
+// command.
+var transferredBytes atomic.Int64
+
+// historyFilePath returns the file keeping the history, next to the
+// configuration.
+func historyFilePath() string {
+	return filepath.Join(filepath.Dir(configFilePath), "history.log")
+}
+
+// withHistory runs the command on path of the current repository and
+// appends its outcome to the history. A history that cannot be written is
+// only warned about, the command itself went through.
+func withHistory(config *Config, command, path string, run func() error) error {
+	transferredBytes.Store(0)
+	err := run()
+	if *dryRunFlag {
+		return err
+	}
+
+	entry := historyEntry{
+		Time:       time.Now(),
+		Command:    command,
+		Repository: config.Current,
+		Path:       path,
+		Bytes:      transferredBytes.Load(),
+		Result:     "ok",
+	}
+	if err != nil {
+		entry.Result = err.Error()
+	}
+	historyErr := appendHistory(entry)
+	if historyErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot write history: %v\n", historyErr)
+	}
+	return err
+}
+
+func appendHistory(entry historyEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(historyFilePath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// showHistory prints the last entries of the history, 10 unless count is
+// given, or empties it with --clear.
+func showHistory(count string) error {
+	if *clearFlag {
+		err := os.Remove(historyFilePath())
+		if err != nil && !os.IsNotExist(err) {
+			return transferError(fmt.Errorf("cannot clear history: %w", err))
+		}
+		infof("History cleared\n")
+		return nil
+	}
+
+	last := 10
+	if count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil || n <= 0 {
+			return usageError(fmt.Errorf("invalid number of entries '%s'", count))
+		}
+		last = n
+	}
+
+	file, err := os.Open(historyFilePath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return transferError(fmt.Errorf("cannot read history: %w", err))
+	}
+	defer file.Close()
+
+	// Keep the last entries only, the history may be long
+	var entries []historyEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var entry historyEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return transferError(fmt.Errorf("%s:%d: invalid history entry: %v", historyFilePath(), line, err))
+		}
+		entries = append(entries, entry)
+		if len(entries) > last {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return transferError(fmt.Errorf("cannot read history: %w", err))
+	}
+
+	for _, entry := range entries {
+		size := "-"
+		if entry.Bytes > 0 {
+			size = humanizeBytes(entry.Bytes)
+		}
+		fmt.Printf("%s  %-4s %-10s %8s  %s  %s\n", entry.Time.Local().Format("2006-01-02 15:04:05"),
+			entry.Command, entry.Repository, size, entry.Path, entry.Result)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// sharedSSHClients holds the SSH connections of an interactive session by
+// repository name, nil outside of one.
+var sharedSSHClients map[string]*goph.Client
+
+// borrowedConn is a shared SSH connection that commands may use but not
+// close.
+type borrowedConn struct {
+	*ssh.Client
+}
+
+func (c borrowedConn) Close() error {
+	return nil
+}
+
+// borrowSSHClient returns a client over the connection of shared, so that
+// the commands closing their client once done leave it open.
+func borrowSSHClient(shared *goph.Client) *goph.Client {
+	// The shared client handles what the server opens
+	chans := make(chan ssh.NewChannel)
+	close(chans)
+	reqs := make(chan *ssh.Request)
+	close(reqs)
+	return &goph.Client{Client: ssh.NewClient(borrowedConn{shared.Client}, chans, reqs), Config: shared.Config}
+}
+
+// flagState is the value of every flag, restored before each command of an
+// interactive session.
+type flagState struct {
+	values           map[string]string
+	include, exclude patternsFlag
+}
+
+func saveFlags() flagState {
+	state := flagState{
+		values:  map[string]string{},
+		include: append(patternsFlag(nil), includeFlag...),
+		exclude: append(patternsFlag(nil), excludeFlag...),
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		state.values[f.Name] = f.Value.String()
+	})
+	return state
+}
+
+func restoreFlags(state flagState) {
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "include" && f.Name != "exclude" {
+			f.Value.Set(state.values[f.Name])
+		}
+	})
+	includeFlag = append(patternsFlag(nil), state.include...)
+	excludeFlag = append(patternsFlag(nil), state.exclude...)
+}
+
+// splitCommandLine splits a line typed in an interactive session into words,
+// keeping together what is quoted with ' or " and what is escaped with \.
+func splitCommandLine(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord || escaped {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// interactive reads commands, with their flags, on stdin and runs them one
+// after the other against config until quit, exit or the end of the input.
+// The SSH connection of each repository is opened once for the session.
+// Flags given to 'interactive' itself apply to every command.
+func interactive(config *Config) error {
+	sharedSSHClients = map[string]*goph.Client{}
+	defer func() {
+		for _, client := range sharedSSHClients {
+			client.Close()
+		}
+		sharedSSHClients = nil
+	}()
+
+	// The flag package reports bad flags itself, the usage would be noise
+	saved := saveFlags()
+	flag.Usage = func() {}
+	defer func() {
+		flag.Usage = printUsage
+	}()
+
+	prompt := term.IsTerminal(int(os.Stdin.Fd()))
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if prompt {
+			fmt.Printf("%s> ", promptTarget(config))
+		}
+		if !scanner.Scan() {
+			if prompt {
+				fmt.Println()
+			}
+			return scanner.Err()
+		}
+
+		words, err := splitCommandLine(scanner.Text())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			continue
+		}
+		if len(words) == 0 {
+			continue
+		}
+
+		// Flags of a command only last for it
+		restoreFlags(saved)
+		args, err := parseArgs(words)
+		if err == flag.ErrHelp {
+			printUsage()
+			continue
+		} else if err != nil {
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		err = setVerbosity()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			continue
+		}
+		err = setFileFilters()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			continue
+		}
+		if *ignoreFlag != saved.values["exclude-from"] {
+			err = loadExcludeFrom()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				continue
+			}
+		}
+
+		switch args[0] {
+		case "quit", "exit":
+			return nil
+		case "help":
+			printUsage()
+			continue
+		case "ls":
+			args[0] = "show"
+		case "interactive":
+			fmt.Fprintln(os.Stderr, "Error: already in an interactive session")
+			continue
+		}
+
+		err = runPicked(config, args)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+	}
+}
+
+// runPicked runs a command of an interactive session, on the repository
+// given with --repo if any.
+func runPicked(config *Config, args []string) error {
+	if *repoFlag != "" && *repoFlag != config.Current {
+		restore, err := pickRepository(config, *repoFlag)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+	return runCommand(config, args)
+}
+
+// promptTarget returns the current repository and its path, shown by the
+// prompt of an interactive session.
+func promptTarget(config *Config) string {
+	repo, ok := config.Repositories[config.Current]
+	if !ok {
+		return "0s"
+	}
+	return fmt.Sprintf("%s:%s", config.Current, repo.Path)
+}
@@ -0,0 +1,112 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+// limitBurst is the largest chunk read at once from a rate-limited reader.
+const limitBurst = 32 * 1024
+
+// limiter caps the bandwidth of all transfers together, nil when no --limit
+// was given.
+var limiter *rate.Limiter
+
+// parseRate converts a rate such as 512K, 2M or 1.5G into bytes per second.
+// Suffixes are binary multiples and may be followed by B, e.g. 2MB.
+func parseRate(s string) (int64, error) {
+	number, err := parseBytes(s)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid rate '%s', use a number of bytes per second with an optional K, M or G suffix", s)
+	}
+	bytesPerSecond := int64(number)
+	if bytesPerSecond < 1 {
+		bytesPerSecond = 1
+	}
+	return bytesPerSecond, nil
+}
+
+// parseSize converts a size such as 512K, 100M or 1.5G into bytes, with
+// the same suffixes as parseRate.
+func parseSize(s string) (int64, error) {
+	number, err := parseBytes(s)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size '%s', use a number of bytes with an optional K, M or G suffix", s)
+	}
+	return int64(number), nil
+}
+
+// parseBytes converts a number of bytes with an optional binary suffix.
+func parseBytes(s string) (float64, error) {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	return number * float64(multiplier), nil
+}
+
+// setLimit sets up the limiter shared by all transfers from the --limit flag.
+func setLimit(s string) error {
+	bytesPerSecond, err := parseRate(s)
+	if err != nil {
+		return err
+	}
+	burst := limitBurst
+	if bytesPerSecond < limitBurst {
+		burst = int(bytesPerSecond)
+	}
+	limiter = rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+	return nil
+}
+
+// limitedReader is a reader throttled by the shared limiter.
+type limitedReader struct {
+	r io.Reader
+}
+
+// limitReader returns r throttled to the --limit rate if transfers are
+// limited, and ending once the command is stopped.
+func limitReader(r io.Reader) io.Reader {
+	r = &operationReader{r: r}
+	if limiter == nil {
+		return r
+	}
+	return &limitedReader{r: r}
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limiter.Burst() {
+		p = p[:limiter.Burst()]
+	}
+	n, err := l.r.Read(p)
+	if n > 0 {
+		waitErr := limiter.WaitN(operation, n)
+		// Waits past the deadline fail at once, the command stops at it
+		if waitErr != nil && err == nil {
+			<-operation.Done()
+			err = operationErr()
+		}
+	}
+	return n, err
+}
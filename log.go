@@ -0,0 +1,56 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Verbosity levels, from --quiet to --verbose.
+const (
+	logQuiet = iota
+	logInfo
+	logVerbose
+)
+
+// verbosity is the level of the messages printed, set by setVerbosity.
+var verbosity = logInfo
+
+// setVerbosity sets the level of the messages printed from --quiet and
+// --verbose.
+func setVerbosity() error {
+	switch {
+	case *quietFlag && *verboseFlag:
+		return errors.New("--quiet and --verbose cannot be used together")
+	case *quietFlag:
+		verbosity = logQuiet
+	case *verboseFlag:
+		verbosity = logVerbose
+	}
+	return nil
+}
+
+// logf prints a diagnostic message on stderr if the verbosity reaches level,
+// keeping stdout for the output of commands.
+func logf(level int, format string, args ...any) {
+	if verbosity >= level {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// infof prints an informational message on stdout, such as the files
+// transferred, unless --quiet was given. Stdout is left to the JSON lines
+// with --output json.
+func infof(format string, args ...any) {
+	if verbosity < logInfo {
+		return
+	}
+	if jsonOutput() {
+		fmt.Fprintf(os.Stderr, format, args...)
+		return
+	}
+	fmt.Printf(format, args...)
+}
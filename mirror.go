@@ -0,0 +1,321 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mirrorEntry is the state of a file on both sides after the last mirror.
+// Times are Unix seconds, as not all servers keep more.
+type mirrorEntry struct {
+	Size        int64 `json:"size"`
+	LocalMTime  int64 `json:"local_mtime"`
+	RemoteMTime int64 `json:"remote_mtime"`
+}
+
+// mirrorBaseline holds the files of a mirrored pair of directories by slash
+// separated relative path.
+type mirrorBaseline map[string]mirrorEntry
+
+// mirrorStats counts what a mirror did.
+type mirrorStats struct {
+	uploaded   int
+	downloaded int
+	deleted    int
+	conflicts  int
+}
+
+// mirrorRemote reaches the repository side of a mirror, relative paths being
+// slash separated.
+type mirrorRemote struct {
+	walk     func() (map[string]os.FileInfo, error)
+	stat     func(relPath string) (os.FileInfo, error)
+	open     func(relPath string) (io.ReadCloser, error)
+	upload   func(localItemPath, relPath string) error
+	download func(relPath, localItemPath string) error
+	remove   func(relPath string) error
+}
+
+// mirrorFilePath returns the file keeping the mirror baselines, next to the
+// configuration.
+func mirrorFilePath() string {
+	return filepath.Join(filepath.Dir(configFilePath), "mirror.json")
+}
+
+// mirrorKey identifies a mirrored pair of directories in the baselines file.
+func mirrorKey(repoName, remotePath, localPath string) string {
+	return fmt.Sprintf("%s:%s|%s", repoName, remotePath, localPath)
+}
+
+// loadMirrorBaselines reads the baselines of all the mirrored pairs, none if
+// nothing was mirrored yet.
+func loadMirrorBaselines() (map[string]mirrorBaseline, error) {
+	baselines := map[string]mirrorBaseline{}
+	byteValue, err := ioutil.ReadFile(mirrorFilePath())
+	if os.IsNotExist(err) {
+		return baselines, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(byteValue, &baselines)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing '%s': %v", mirrorFilePath(), err)
+	}
+	return baselines, nil
+}
+
+func saveMirrorBaselines(baselines map[string]mirrorBaseline) error {
+	byteValue, err := json.MarshalIndent(baselines, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(mirrorFilePath(), byteValue, 0644)
+}
+
+// renameMirrorBaselines moves the baselines of the repository oldName to
+// newName.
+func renameMirrorBaselines(oldName, newName string) error {
+	baselines, err := loadMirrorBaselines()
+	if err != nil {
+		return err
+	}
+
+	if len(baselines) == 0 {
+		return nil
+	}
+
+	renamed := map[string]mirrorBaseline{}
+	for key, base := range baselines {
+		if strings.HasPrefix(key, oldName+":") {
+			key = newName + strings.TrimPrefix(key, oldName)
+		}
+		renamed[key] = base
+	}
+	return saveMirrorBaselines(renamed)
+}
+
+// walkLocalFiles returns the regular files below root by slash separated
+// relative path, leaving out those filtered by --include and --exclude.
+func walkLocalFiles(root string) (map[string]os.FileInfo, error) {
+	files := map[string]os.FileInfo{}
+	err := filepath.Walk(root, func(itemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking local directory: %v", err)
+		}
+
+		relPath, err := filepath.Rel(root, itemPath)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		if skipEntry(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			files[filepath.ToSlash(relPath)] = info
+		}
+		return nil
+	})
+	return files, err
+}
+
+// changedSince tells whether a file differs from its state in the baseline.
+func changedSince(info os.FileInfo, inBase bool, size, mtime int64) bool {
+	if info == nil || !inBase {
+		return info != nil || inBase
+	}
+	return info.Size() != size || info.ModTime().Unix() != mtime
+}
+
+// sameContents tells whether the local file and the repository one at
+// relPath hold the same data.
+func sameContents(localItemPath, relPath string, remote mirrorRemote) (bool, error) {
+	localFile, err := os.Open(localItemPath)
+	if err != nil {
+		return false, err
+	}
+	defer localFile.Close()
+	localSum, err := sha256Sum(localFile)
+	if err != nil {
+		return false, err
+	}
+
+	remoteFile, err := remote.open(relPath)
+	if err != nil {
+		return false, err
+	}
+	defer remoteFile.Close()
+	remoteSum, err := sha256Sum(remoteFile)
+	if err != nil {
+		return false, err
+	}
+
+	return localSum == remoteSum, nil
+}
+
+// mirrorTree makes the files under localPath and the repository side the
+// same. A file changed on one side only since base is copied to the other,
+// the newer one wins for files unknown to base, and files changed on both
+// sides are reported as conflicts and left alone. Files deleted on one side
+// are deleted on the other with --delete only. It returns the new baseline.
+func mirrorTree(localPath string, base mirrorBaseline, remote mirrorRemote) (mirrorStats, mirrorBaseline, error) {
+	var stats mirrorStats
+
+	localFiles, err := walkLocalFiles(localPath)
+	if err != nil {
+		return stats, nil, err
+	}
+	remoteFiles, err := remote.walk()
+	if err != nil {
+		return stats, nil, err
+	}
+
+	// Every path known to either side or to the baseline, in order
+	var relPaths []string
+	known := map[string]bool{}
+	for _, files := range []map[string]os.FileInfo{localFiles, remoteFiles} {
+		for relPath := range files {
+			if !known[relPath] {
+				known[relPath] = true
+				relPaths = append(relPaths, relPath)
+			}
+		}
+	}
+	for relPath := range base {
+		if !known[relPath] && !skipEntry(relPath, false) {
+			known[relPath] = true
+			relPaths = append(relPaths, relPath)
+		}
+	}
+	sort.Strings(relPaths)
+
+	next := mirrorBaseline{}
+	for _, relPath := range relPaths {
+		localInfo, remoteInfo := localFiles[relPath], remoteFiles[relPath]
+		entry, inBase := base[relPath]
+		localItemPath := filepath.Join(localPath, filepath.FromSlash(relPath))
+		localChanged := changedSince(localInfo, inBase, entry.Size, entry.LocalMTime)
+		remoteChanged := changedSince(remoteInfo, inBase, entry.Size, entry.RemoteMTime)
+
+		var transfer func() error
+		switch {
+		case !localChanged && !remoteChanged:
+			if localInfo != nil {
+				next[relPath] = entry
+			}
+			continue
+		case localInfo == nil && remoteInfo == nil:
+			// Deleted on both sides
+			continue
+		case !inBase && localInfo != nil && remoteInfo != nil && localInfo.Size() == remoteInfo.Size() &&
+			localInfo.ModTime().Unix() == remoteInfo.ModTime().Unix():
+			// Both sides already agree before the first mirror
+		case inBase && localChanged && remoteChanged,
+			!inBase && localInfo != nil && remoteInfo != nil && localInfo.ModTime().Unix() == remoteInfo.ModTime().Unix():
+			// Times cannot tell, e.g. when one side was copied over the
+			// other by hand
+			if localInfo != nil && remoteInfo != nil && localInfo.Size() == remoteInfo.Size() {
+				same, err := sameContents(localItemPath, relPath, remote)
+				if err != nil {
+					return stats, nil, err
+				}
+				if same {
+					break
+				}
+			}
+			if localInfo == nil || remoteInfo == nil {
+				fmt.Fprintf(os.Stderr, "Conflict: '%s' changed on one side and deleted on the other\n", relPath)
+			} else {
+				fmt.Fprintf(os.Stderr, "Conflict: '%s' changed on both sides\n", relPath)
+			}
+			stats.conflicts++
+			if inBase {
+				next[relPath] = entry
+			}
+			continue
+		case localInfo == nil || remoteInfo == nil:
+			if !inBase {
+				// New on one side
+				if localInfo != nil {
+					transfer = func() error { return remote.upload(localItemPath, relPath) }
+					stats.uploaded++
+				} else {
+					transfer = func() error { return remote.download(relPath, localItemPath) }
+					stats.downloaded++
+				}
+				break
+			}
+
+			// Deleted on one side, unchanged on the other
+			if !*deleteFlag {
+				fmt.Fprintf(os.Stderr, "Warning: '%s' was deleted on one side, use --delete to delete it on the other\n", relPath)
+				next[relPath] = entry
+				continue
+			}
+			stats.deleted++
+			if *dryRunFlag {
+				fmt.Printf("Would delete '%s'\n", relPath)
+				continue
+			}
+			var err error
+			if localInfo != nil {
+				err = os.Remove(localItemPath)
+			} else {
+				err = remote.remove(relPath)
+			}
+			if err != nil {
+				return stats, nil, fmt.Errorf("cannot delete '%s': %v", relPath, err)
+			}
+			infof("Deleted '%s'\n", relPath)
+			continue
+		case localChanged && (inBase || localInfo.ModTime().After(remoteInfo.ModTime())):
+			transfer = func() error { return remote.upload(localItemPath, relPath) }
+			stats.uploaded++
+		default:
+			transfer = func() error { return remote.download(relPath, localItemPath) }
+			stats.downloaded++
+		}
+
+		if transfer != nil {
+			err = transfer()
+			if err != nil {
+				return stats, nil, err
+			}
+			if *dryRunFlag {
+				continue
+			}
+
+			// Times may not be kept, e.g. with --no-perms
+			localInfo, err = os.Stat(localItemPath)
+			if err != nil {
+				return stats, nil, err
+			}
+			remoteInfo, err = remote.stat(relPath)
+			if err != nil {
+				return stats, nil, err
+			}
+		}
+		next[relPath] = mirrorEntry{
+			Size:        localInfo.Size(),
+			LocalMTime:  localInfo.ModTime().Unix(),
+			RemoteMTime: remoteInfo.ModTime().Unix(),
+		}
+	}
+
+	return stats, next, nil
+}
@@ -0,0 +1,82 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// openRepository fetches the repository file name to a temporary directory
+// and opens it with the default application of the system. The file is
+// removed once the application exits, where the launcher waits for it to.
+func openRepository(config *Config, name string) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	// Get file path, making sure it stays inside the repository
+	filePath, err := resolvePath(&repo, name)
+	if err != nil {
+		return usageError(err)
+	}
+
+	// Fetch the file under its own name, for the system to pick the
+	// application from its extension
+	tempDir, err := os.MkdirTemp("", "0s-open-")
+	if err != nil {
+		return transferError(fmt.Errorf("cannot create temporary directory: %w", err))
+	}
+	tempPath := filepath.Join(tempDir, filepath.Base(filePath))
+
+	tempFile, err := os.Create(tempPath)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return transferError(fmt.Errorf("cannot create temporary file: %w", err))
+	}
+	err = copyRepositoryFile(config, name, tempFile, "open")
+	tempFile.Close()
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return err
+	}
+
+	cmd, waits := openCommand(tempPath)
+	err = cmd.Run()
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return fmt.Errorf("cannot open '%s' with '%s': %v", name, cmd.Path, err)
+	}
+
+	// xdg-open returns at once, the application may still need the file
+	if !waits {
+		infof("Opened '%s', fetched to '%s'\n", name, tempPath)
+		return nil
+	}
+	os.RemoveAll(tempDir)
+	return nil
+}
+
+// openCommand returns the command opening file with the default application
+// of the system, and whether it waits for the application to exit.
+func openCommand(file string) (*exec.Cmd, bool) {
+	var cmd *exec.Cmd
+	waits := true
+	switch runtime.GOOS {
+	case "windows":
+		// The empty title keeps start from taking the file for one
+		cmd = exec.Command("cmd", "/C", "start", "", "/WAIT", file)
+	case "darwin":
+		cmd = exec.Command("open", "-W", file)
+	default:
+		cmd = exec.Command("xdg-open", file)
+		waits = false
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd, waits
+}
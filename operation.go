@@ -0,0 +1,84 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// errInterrupted stops the command on Ctrl-C or SIGTERM.
+var errInterrupted = errors.New("interrupted")
+
+// stopGrace is how long the transfers of a stopped command have to remove
+// their partial files before their connections are closed under them.
+const stopGrace = 2 * time.Second
+
+// operation is the context of the running command, cancelled when its
+// --deadline is reached, on Ctrl-C or SIGTERM.
+var operation = context.Background()
+
+// startOperation sets up the context of a command from --deadline, Ctrl-C
+// and SIGTERM. It returns the function to call once the command is done.
+// A second signal ends the program at once.
+func startOperation() (func(), error) {
+	if *deadlineFlag < 0 {
+		return nil, fmt.Errorf("invalid deadline '%s'", *deadlineFlag)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	cancel := context.CancelFunc(func() {})
+	if *deadlineFlag > 0 {
+		ctx, cancel = context.WithTimeout(ctx, *deadlineFlag)
+	}
+	operation = ctx
+
+	return func() {
+		cancel()
+		stop()
+		operation = context.Background()
+	}, nil
+}
+
+// operationErr tells why the command was stopped, nil while it may go on.
+func operationErr() error {
+	switch {
+	case operation.Err() == nil:
+		return nil
+	case errors.Is(operation.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("deadline of %s exceeded", *deadlineFlag)
+	}
+	return errInterrupted
+}
+
+// operationReader is a reader failing once the command is stopped, so that
+// copies end between two reads.
+type operationReader struct {
+	r io.Reader
+}
+
+func (o *operationReader) Read(p []byte) (int, error) {
+	err := operationErr()
+	if err != nil {
+		return 0, err
+	}
+	return o.r.Read(p)
+}
+
+// closeWhenStopped closes client once the command is stopped, after the
+// grace left to its transfers to clean up, so that stalled ones end.
+func closeWhenStopped(client io.Closer) {
+	context.AfterFunc(operation, func() {
+		time.AfterFunc(stopGrace, func() {
+			client.Close()
+		})
+	})
+}
@@ -0,0 +1,105 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// pingRepositories tells whether the repository name, the current one if
+// name is empty or all of them with --all, can be reached, and how long it
+// took. Repositories are only reached if their configuration is valid.
+func pingRepositories(config *Config, name string) error {
+	var names []string
+	switch {
+	case *allFlag:
+		for repoName := range config.Repositories {
+			names = append(names, repoName)
+		}
+		sort.Strings(names)
+	case name != "":
+		if _, ok := config.Repositories[name]; !ok {
+			return configError(fmt.Errorf("repository '%s' not found", name))
+		}
+		names = []string{name}
+	default:
+		names = []string{config.Current}
+	}
+
+	problems := map[string]error{}
+	for _, problem := range validateConfig(config) {
+		var p *configProblem
+		if errors.As(problem, &p) && problems[p.repo] == nil {
+			problems[p.repo] = p.err
+		}
+	}
+
+	failed := 0
+	for _, repoName := range names {
+		repo := config.Repositories[repoName]
+		err := problems[repoName]
+		var latency time.Duration
+		if err == nil {
+			start := time.Now()
+			err = pingRepository(&repo)
+			latency = time.Since(start)
+		}
+		if err != nil {
+			fmt.Printf("FAIL  %-16s %-8s %v\n", repoName, repo.Type, err)
+			failed++
+			continue
+		}
+		fmt.Printf("OK    %-16s %-8s %v\n", repoName, repo.Type, latency.Round(time.Microsecond))
+	}
+
+	if *allFlag {
+		fmt.Printf("%d repositories pinged, %d reachable, %d failed\n", len(names), len(names)-failed, failed)
+	}
+	if failed > 0 {
+		return connectionError(fmt.Errorf("%d repositories could not be reached", failed))
+	}
+	return nil
+}
+
+// pingRepository reaches repo the cheapest way: a stat of its directory,
+// over SFTP for SSH, or a listing of it for the other remote types.
+func pingRepository(repo *Repository) error {
+	switch repo.Type {
+	case "local", "network":
+		if useSMB(repo) {
+			_, err := listFiles(repo)
+			return err
+		}
+		info, err := os.Stat(repo.Path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("'%s' is not a directory", repo.Path)
+		}
+		return nil
+	case "ssh":
+		client, err := getSSHClient(repo)
+		if err != nil {
+			return fmt.Errorf("cannot connect to SSH server: %w", err)
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return fmt.Errorf("cannot create SFTP client: %w", err)
+		}
+		defer sftp.Close()
+
+		_, err = sftp.Stat(filepath.ToSlash(repo.Path))
+		return err
+	}
+	_, err := listFiles(repo)
+	return err
+}
@@ -0,0 +1,158 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/net/proxy"
+)
+
+// parseProxyURL checks a proxy URL of a repository, socks5://, socks5h://
+// or http://, with optional user:password@ credentials.
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%s', use socks5, socks5h or http", proxyURL.Scheme)
+	}
+	if proxyURL.Hostname() == "" {
+		return nil, fmt.Errorf("proxy URL '%s' has no host", proxyURL.Redacted())
+	}
+	return proxyURL, nil
+}
+
+// redactProxy returns a proxy URL without its password, for display.
+func redactProxy(rawURL string) string {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return proxyURL.Redacted()
+}
+
+// newSSHConn connects to the SSH server of config through dial, e.g. a
+// proxy or a jump host, or directly if dial is nil. goph only dials
+// directly, so the client is built from the dialed connection otherwise.
+func newSSHConn(config *goph.Config, dial func(network, addr string) (net.Conn, error)) (*goph.Client, error) {
+	if dial == nil {
+		return goph.NewConn(config)
+	}
+
+	addr := net.JoinHostPort(config.Addr, strconv.FormatUint(uint64(config.Port), 10))
+	conn, err := dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not wait forever for a silent server, as ssh.Dial would not
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            config.Auth,
+		Timeout:         config.Timeout,
+		HostKeyCallback: config.Callback,
+		BannerCallback:  config.BannerCallback,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &goph.Client{Client: ssh.NewClient(clientConn, chans, reqs), Config: config}, nil
+}
+
+// getProxyDialer returns the dialer going through the proxy at rawURL.
+func getProxyDialer(rawURL string, timeout time.Duration) (proxy.Dialer, error) {
+	proxyURL, err := parseProxyURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	forward := &net.Dialer{Timeout: timeout}
+	if proxyURL.Scheme == "http" {
+		return &httpProxyDialer{proxyURL: proxyURL, forward: forward}, nil
+	}
+
+	// socks5h leaves name resolution to the proxy, which the SOCKS5
+	// dialer always does
+	if proxyURL.Scheme == "socks5h" {
+		proxyURL.Scheme = "socks5"
+	}
+	return proxy.FromURL(proxyURL, forward)
+}
+
+// httpProxyDialer opens connections through an HTTP proxy with CONNECT.
+type httpProxyDialer struct {
+	proxyURL *url.URL
+	forward  *net.Dialer
+}
+
+func (d *httpProxyDialer) Dial(network, addr string) (net.Conn, error) {
+	proxyAddr := d.proxyURL.Host
+	if d.proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(d.proxyURL.Hostname(), "80")
+	}
+	conn, err := d.forward.Dial(network, proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if user := d.proxyURL.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	err = request.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused to connect to '%s': %s", addr, response.Status)
+	}
+
+	// The server may have spoken already, keep what was buffered
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn reads a connection through the reader that buffered its
+// first bytes.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,67 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// retryDelay is the wait before the first retry, doubled on each attempt.
+const retryDelay = time.Second
+
+// retry calls fn until it succeeds, fails with an error that is not
+// transient, or has been retried --retries times. Each retry is reported on
+// stderr along with the delay before it.
+func retry(what string, fn func() error) error {
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		// Nothing more is started once the command is stopped
+		if stopped := operationErr(); stopped != nil {
+			return stopped
+		}
+		err := fn()
+		if err == nil || attempt > *retriesFlag || !isTransient(err) {
+			return err
+		}
+		// A connection closed by the end of the command is not retried
+		if stopped := operationErr(); stopped != nil {
+			return stopped
+		}
+		logf(logInfo, "%s failed: %v, retrying in %s (%d/%d)\n", what, err, delay, attempt, *retriesFlag)
+		select {
+		case <-time.After(delay):
+		case <-operation.Done():
+			return operationErr()
+		}
+		delay *= 2
+	}
+}
+
+// isTransient tells whether err may go away by trying again: dropped
+// connections, timeouts and streams cut short. Permission and not found
+// errors are not.
+func isTransient(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, os.ErrPermission), errors.Is(err, os.ErrNotExist):
+		return false
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED), errors.Is(err, syscall.EPIPE):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	// Some libraries flatten the cause into the message, e.g. the SSH
+	// handshake
+	case strings.HasSuffix(err.Error(), "EOF"), strings.Contains(err.Error(), "connection reset by peer"):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,229 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func getS3Client(repo *Repository) (*s3.Client, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if repo.Region != "" {
+		options = append(options, awsconfig.WithRegion(repo.Region))
+	}
+	// Use the configured keys, otherwise the usual AWS environment and files
+	if repo.AccessKey != "" {
+		provider := credentials.NewStaticCredentialsProvider(repo.AccessKey, repo.SecretKey, "")
+		options = append(options, awsconfig.WithCredentialsProvider(provider))
+	}
+
+	awsConfig, err := awsconfig.LoadDefaultConfig(operation, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		// Custom endpoints (e.g. MinIO) usually need path-style addressing
+		if repo.Endpoint != "" {
+			o.BaseEndpoint = aws.String(repo.Endpoint)
+			o.UsePathStyle = true
+		}
+	}), nil
+}
+
+// objectKey joins name to the key prefix of an object store repository.
+func objectKey(prefix, name string) string {
+	return strings.TrimPrefix(path.Join("/", prefix, filepath.ToSlash(name)), "/")
+}
+
+// dirPrefix returns the prefix to list the contents of a "directory" key.
+func dirPrefix(key string) string {
+	if key == "" {
+		return ""
+	}
+	return key + "/"
+}
+
+func listS3Directory(client *s3.Client, bucket, key string) ([]os.FileInfo, error) {
+	prefix := dirPrefix(key)
+	var files []os.FileInfo
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(operation)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, commonPrefix := range page.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(aws.ToString(commonPrefix.Prefix), prefix), "/")
+			files = append(files, objectInfo{name: name, dir: true})
+		}
+		for _, object := range page.Contents {
+			name := strings.TrimPrefix(aws.ToString(object.Key), prefix)
+			if name == "" {
+				continue
+			}
+			files = append(files, objectInfo{
+				name:    name,
+				size:    aws.ToInt64(object.Size),
+				modTime: aws.ToTime(object.LastModified),
+			})
+		}
+	}
+
+	return files, nil
+}
+
+// isS3Directory tells whether key is a prefix holding other objects.
+func isS3Directory(client *s3.Client, bucket, key string) (bool, error) {
+	output, err := client.ListObjectsV2(operation, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(dirPrefix(key)),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(output.Contents) > 0, nil
+}
+
+func downloadS3Object(client *s3.Client, bucket, key, localPath string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would download 's3://%s/%s' to '%s'\n", bucket, key, localPath)
+		return nil
+	}
+
+	logf(logVerbose, "Downloading 's3://%s/%s' to '%s'\n", bucket, key, localPath)
+	report := startTransfer("download", "s3://"+bucket+"/"+key, localPath)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Get remote object
+	output, err := client.GetObject(operation, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return fmt.Errorf("object '%s' does not exist", key)
+		}
+		return fmt.Errorf("could not get object: %v", err)
+	}
+	defer output.Body.Close()
+
+	// Copy contents to the local file
+	err = writeLocalFile(localPath, output.Body, nil)
+	if err != nil {
+		return fmt.Errorf("could not write local file: %v", err)
+	}
+
+	report.done(localSize(localPath), "Downloaded object '%s'\n", key)
+	return nil
+}
+
+func downloadS3Directory(client *s3.Client, bucket, key, localPath string) error {
+	prefix := dirPrefix(key)
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(operation)
+		if err != nil {
+			return fmt.Errorf("error listing objects: %v", err)
+		}
+
+		for _, object := range page.Contents {
+			objectKey := aws.ToString(object.Key)
+			relPath := strings.TrimPrefix(objectKey, prefix)
+			if relPath == "" || strings.HasSuffix(relPath, "/") {
+				continue
+			}
+
+			localItemPath := filepath.Join(localPath, filepath.FromSlash(relPath))
+			err = makeLocalDirectory(filepath.Dir(localItemPath))
+			if err != nil {
+				return err
+			}
+
+			err = downloadS3Object(client, bucket, objectKey, localItemPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func uploadS3Object(client *s3.Client, bucket, localPath, key string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would upload '%s' to 's3://%s/%s'\n", localPath, bucket, key)
+		return nil
+	}
+
+	logf(logVerbose, "Uploading '%s' to 's3://%s/%s'\n", localPath, bucket, key)
+	report := startTransfer("upload", localPath, "s3://"+bucket+"/"+key)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Open local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("could not open local file: %v", err)
+	}
+	defer localFile.Close()
+
+	// Put remote object
+	_, err = client.PutObject(operation, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   localFile,
+	})
+	if err != nil {
+		return fmt.Errorf("could not put object: %v", err)
+	}
+
+	report.done(localSize(localPath), "Uploaded file '%s'\n", localPath)
+	return nil
+}
+
+func uploadS3Directory(client *s3.Client, bucket, localPath, key string) error {
+	// Walk local directory contents, object stores have no real directories
+	return filepath.Walk(localPath, func(localItemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking local directory: %v", err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(localPath, localItemPath)
+		if err != nil {
+			return err
+		}
+
+		return uploadS3Object(client, bucket, localItemPath, objectKey(key, relPath))
+	})
+}
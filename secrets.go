@@ -0,0 +1,50 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// resolvePassword returns the password configured as value: the contents of
+// a file with file:<path>, what a command prints with cmd:<command>, such as
+// a password manager, or value itself otherwise. Trailing newlines are
+// dropped.
+func resolvePassword(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "file:"):
+		homeDir, _ := os.UserHomeDir()
+		path := expandConfigPath(strings.TrimPrefix(value, "file:"), homeDir)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot read password file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, "cmd:"):
+		command := strings.TrimPrefix(value, "cmd:")
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", command)
+		} else {
+			cmd = exec.Command("sh", "-c", command)
+		}
+		// The command may prompt, e.g. to unlock a password store
+		var stdout bytes.Buffer
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		logf(logVerbose, "Running '%s' for the password\n", command)
+		err := cmd.Run()
+		if err != nil {
+			return "", fmt.Errorf("password command '%s' failed: %v", command, err)
+		}
+		return strings.TrimSpace(stdout.String()), nil
+	}
+	return value, nil
+}
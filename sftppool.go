@@ -0,0 +1,94 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"sync"
+
+	"github.com/melbahja/goph"
+	"github.com/pkg/sftp"
+)
+
+// sftpPool lends the SFTP sessions of one SSH connection to parallel
+// transfers, opening up to --sessions of them as needed. A session is lent
+// to several transfers at once when all are opened, or when the server
+// refuses another one.
+type sftpPool struct {
+	client *goph.Client
+	main   *sftp.Client
+	size   int
+
+	mu       sync.Mutex
+	sessions []*sftp.Client
+	lent     []int
+}
+
+// newSFTPPool returns a pool of the sessions of client, main being the one
+// already opened, which stays the caller's to close.
+func newSFTPPool(client *goph.Client, main *sftp.Client) *sftpPool {
+	size := *sessionsFlag
+	if size < 1 {
+		size = 1
+	}
+	return &sftpPool{
+		client:   client,
+		main:     main,
+		size:     size,
+		sessions: []*sftp.Client{main},
+		lent:     []int{0},
+	}
+}
+
+// get lends the least busy session, opening a new one if they are all busy
+// and the pool is not full.
+func (p *sftpPool) get() *sftp.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	least := 0
+	for i := range p.sessions {
+		if p.lent[i] < p.lent[least] {
+			least = i
+		}
+	}
+	if p.lent[least] > 0 && len(p.sessions) < p.size {
+		session, err := p.client.NewSftp()
+		if err != nil {
+			logf(logVerbose, "Cannot open another SFTP session, sharing the %d opened: %v\n", len(p.sessions), err)
+			p.size = len(p.sessions)
+		} else {
+			p.sessions = append(p.sessions, session)
+			p.lent = append(p.lent, 0)
+			least = len(p.sessions) - 1
+			logf(logVerbose, "Opened SFTP session %d of %d\n", len(p.sessions), p.size)
+		}
+	}
+
+	p.lent[least]++
+	return p.sessions[least]
+}
+
+// put gives back a session lent by get.
+func (p *sftpPool) put(session *sftp.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.sessions {
+		if p.sessions[i] == session {
+			p.lent[i]--
+			return
+		}
+	}
+}
+
+// Close closes the sessions opened by the pool.
+func (p *sftpPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, session := range p.sessions[1:] {
+		session.Close()
+	}
+	p.sessions, p.lent = p.sessions[:1], p.lent[:1]
+}
@@ -0,0 +1,362 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// smbShare is an SMB share mounted over its own session, standing in for a
+// network repository whose path is not mounted locally.
+type smbShare struct {
+	*smb2.Share
+	conn    net.Conn
+	session *smb2.Session
+	dir     string // directory of the share URL, relative to the share
+}
+
+// useSMB tells whether repo has to be reached over SMB, which is when it has
+// a share URL, or a UNC path, and its path is not accessible.
+func useSMB(repo *Repository) bool {
+	if repo.Type != "network" || smbShareURL(repo) == "" {
+		return false
+	}
+	_, err := os.Stat(repo.Path)
+	return err != nil
+}
+
+// smbShareURL returns the URL repo is reached at over SMB: its share URL, or
+// else its path when it is a UNC path, such as one needing credentials that
+// is not mounted.
+func smbShareURL(repo *Repository) string {
+	if repo.ShareURL == "" && uncRoot(repo.Path) != "" {
+		return repo.Path
+	}
+	return repo.ShareURL
+}
+
+// parseShareURL splits smb://host[:port]/share[/dir] (or //host/share/dir,
+// \\host\share\dir) into the address, share name and directory.
+func parseShareURL(shareURL string) (addr, share, dir string, err error) {
+	shareURL = strings.ReplaceAll(shareURL, `\`, "/")
+	if strings.HasPrefix(shareURL, "//") {
+		shareURL = "smb:" + shareURL
+	}
+
+	u, err := url.Parse(shareURL)
+	if err != nil {
+		return "", "", "", err
+	}
+	if u.Scheme != "smb" || u.Hostname() == "" {
+		return "", "", "", fmt.Errorf("invalid share URL '%s', use smb://host/share/dir", shareURL)
+	}
+
+	parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		return "", "", "", fmt.Errorf("no share name in '%s'", shareURL)
+	}
+	if len(parts) == 2 {
+		dir = parts[1]
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "445"
+	}
+	return net.JoinHostPort(u.Hostname(), port), parts[0], dir, nil
+}
+
+func getSMBShare(repo *Repository) (*smbShare, error) {
+	addr, shareName, dir, err := parseShareURL(smbShareURL(repo))
+	if err != nil {
+		return nil, err
+	}
+	password, err := resolvePassword(repo.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Connect to SMB server
+	logf(logVerbose, "Connecting to '%s', share '%s'\n", addr, shareName)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Log in, the user may be given as DOMAIN\user
+	domain, user := repo.Domain, repo.User
+	if i := strings.Index(user, `\`); i >= 0 {
+		domain, user = user[:i], user[i+1:]
+	}
+	dialer := &smb2.Dialer{
+		Initiator: &smb2.NTLMInitiator{User: user, Password: password, Domain: domain},
+	}
+	session, err := dialer.Dial(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	share, err := session.Mount(shareName)
+	if err != nil {
+		session.Logoff()
+		conn.Close()
+		return nil, err
+	}
+
+	return &smbShare{Share: share, conn: conn, session: session, dir: dir}, nil
+}
+
+func (s *smbShare) Close() {
+	s.Umount()
+	s.session.Logoff()
+	s.conn.Close()
+}
+
+// path joins name to the directory of the share URL.
+func (s *smbShare) path(name string) string {
+	return strings.TrimPrefix(path.Join("/", s.dir, filepath.ToSlash(name)), "/")
+}
+
+// glob is Share.Glob returning slash separated paths.
+func (s *smbShare) glob(pattern string) ([]string, error) {
+	matches, err := s.Glob(pattern)
+	for i := range matches {
+		matches[i] = strings.ReplaceAll(matches[i], `\`, "/")
+	}
+	return matches, err
+}
+
+func getSMBRepository(repo *Repository, name string) error {
+	share, err := getSMBShare(repo)
+	if err != nil {
+		return connectionError(fmt.Errorf("cannot connect to SMB share: %w", err))
+	}
+	defer share.Close()
+
+	// Expand wildcards against the share
+	names := []string{name}
+	if isGlob(name) {
+		names, err = expandGlob(share.glob, share.path(""), share.path(name))
+		if err != nil {
+			return transferError(err)
+		}
+	}
+
+	workDir, err := getDownloadDir(repo)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot get download directory: %w", err))
+	}
+
+	for _, name := range names {
+		remotePath := share.path(name)
+		localPath := filepath.Join(workDir, name)
+
+		// Check if remote path is a directory or a file
+		remoteStat, err := share.Stat(remotePath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot get remote file info: %w", err))
+		}
+
+		if remoteStat.IsDir() {
+			err = downloadSMBDirectory(share, remotePath, localPath)
+		} else {
+			err = downloadSMBFile(share, remotePath, localPath)
+		}
+		if err != nil {
+			return transferError(fmt.Errorf("'get' failed: %w", err))
+		}
+	}
+
+	return nil
+}
+
+func putSMBRepository(repo *Repository, names []string) error {
+	share, err := getSMBShare(repo)
+	if err != nil {
+		return connectionError(fmt.Errorf("cannot connect to SMB share: %w", err))
+	}
+	defer share.Close()
+
+	for _, name := range names {
+		localPath, err := filepath.Abs(name)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot get absolute path: %w", err))
+		}
+		remotePath := share.path(name)
+
+		// Check if local path is a directory or a file
+		localStat, err := os.Stat(localPath)
+		if err != nil {
+			return transferError(fmt.Errorf("cannot get local file info: %w", err))
+		}
+
+		// Make the missing parents of a nested destination, the share root
+		// being always there
+		if parent := path.Dir(remotePath); *parentsFlag && !*dryRunFlag && parent != "." {
+			err = share.MkdirAll(parent, 0755)
+			if err != nil {
+				return transferError(fmt.Errorf("cannot create remote parent directories: %w", err))
+			}
+		}
+
+		if localStat.IsDir() {
+			err = uploadSMBDirectory(share, localPath, remotePath)
+		} else {
+			err = uploadSMBFile(share, localPath, remotePath)
+		}
+		if err != nil {
+			return transferError(fmt.Errorf("'put' failed: %w", err))
+		}
+	}
+
+	return nil
+}
+
+func downloadSMBFile(share *smbShare, remotePath, localPath string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would download '%s' to '%s'\n", remotePath, localPath)
+		return nil
+	}
+
+	logf(logVerbose, "Downloading '%s' to '%s'\n", remotePath, localPath)
+	report := startTransfer("download", remotePath, localPath)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Open remote file
+	remoteFile, err := share.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("could not open remote file: %v", err)
+	}
+	defer remoteFile.Close()
+
+	remoteStat, err := remoteFile.Stat()
+	if err != nil {
+		return fmt.Errorf("could not get remote file info: %v", err)
+	}
+
+	// Copy contents to the local file
+	err = writeLocalFile(localPath, remoteFile, remoteStat)
+	if err != nil {
+		return fmt.Errorf("could not write local file: %v", err)
+	}
+
+	report.done(localSize(localPath), "Downloaded file '%s'\n", remotePath)
+	return nil
+}
+
+func downloadSMBDirectory(share *smbShare, remotePath, localPath string) error {
+	// Create local directory
+	err := makeLocalDirectory(localPath)
+	if err != nil {
+		return err
+	}
+
+	// Download directory contents
+	files, err := share.ReadDir(remotePath)
+	if err != nil {
+		return fmt.Errorf("error reading remote directory: %v", err)
+	}
+	for _, file := range files {
+		remoteItemPath := path.Join(remotePath, file.Name())
+		localItemPath := filepath.Join(localPath, file.Name())
+		if file.IsDir() {
+			err = downloadSMBDirectory(share, remoteItemPath, localItemPath)
+		} else if !skipFile(remoteItemPath, file) {
+			err = downloadSMBFile(share, remoteItemPath, localItemPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uploadSMBFile(share *smbShare, localPath, remotePath string) (err error) {
+	if *dryRunFlag {
+		fmt.Printf("Would upload '%s' to '%s'\n", localPath, remotePath)
+		return nil
+	}
+
+	logf(logVerbose, "Uploading '%s' to '%s'\n", localPath, remotePath)
+	report := startTransfer("upload", localPath, remotePath)
+	defer func() {
+		report.fail(err)
+	}()
+
+	// Open local file
+	localFile, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("could not open local file: %v", err)
+	}
+	defer localFile.Close()
+
+	// Write to a temporary file, renamed into place once complete
+	tmpPath := tempPath(remotePath)
+	remoteFile, err := share.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("could not create remote file: %v", err)
+	}
+	_, err = remoteFile.ReadFrom(limitReader(localFile))
+	remoteFile.Close()
+	if err != nil {
+		share.Remove(tmpPath)
+		return fmt.Errorf("could not copy file contents: %v", err)
+	}
+
+	// SMB renames do not replace existing files
+	share.Remove(remotePath)
+	err = share.Rename(tmpPath, remotePath)
+	if err != nil {
+		share.Remove(tmpPath)
+		return fmt.Errorf("could not rename remote file: %v", err)
+	}
+
+	report.done(localSize(localPath), "Uploaded file '%s'\n", localPath)
+	return nil
+}
+
+func uploadSMBDirectory(share *smbShare, localPath, remotePath string) error {
+	// Walk local directory contents
+	return filepath.Walk(localPath, func(localItemPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error walking local directory: %v", err)
+		}
+
+		relPath, err := filepath.Rel(localPath, localItemPath)
+		if err != nil {
+			return err
+		}
+		remoteItemPath := path.Join(remotePath, filepath.ToSlash(relPath))
+
+		if info.IsDir() {
+			if *dryRunFlag {
+				fmt.Printf("Would create directory '%s'\n", remoteItemPath)
+				return nil
+			}
+
+			err = share.MkdirAll(remoteItemPath, info.Mode().Perm())
+			if err != nil {
+				return fmt.Errorf("could not create remote directory: %v", err)
+			}
+			infof("Created directory '%s'\n", remoteItemPath)
+			return nil
+		}
+
+		if skipFile(localItemPath, info) {
+			return nil
+		}
+		return uploadSMBFile(share, localItemPath, remoteItemPath)
+	})
+}
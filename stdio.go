@@ -0,0 +1,160 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/term"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// getStdout writes the repository file name to stdout, byte for byte. No
+// message is printed, stdout being the file, and neither are transfer
+// events with --output json.
+func getStdout(config *Config, name string) error {
+	stdout := &countingWriter{w: os.Stdout}
+	err := copyRepositoryFile(config, name, stdout, "get --stdout")
+	transferredBytes.Add(stdout.n)
+	return err
+}
+
+// putStdin writes what is piped on stdin to the file name of the current
+// repository. Stdin can only be read once, so the transfer is not retried.
+func putStdin(repo *Repository, name string) error {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		return usageError(fmt.Errorf("nothing piped on stdin for --stdin"))
+	}
+
+	// The name could be meant as the local file to put
+	if _, err := os.Stat(name); err == nil {
+		return usageError(fmt.Errorf("'%s' is a local file, ambiguous with --stdin", name))
+	}
+
+	var destPath string
+	var write func(r io.Reader) error
+	switch repo.Type {
+	case "local", "network":
+		if useSMB(repo) {
+			return usageError(fmt.Errorf("--stdin not implemented yet for shares reached over SMB"))
+		}
+		var err error
+		destPath, err = resolvePath(repo, name)
+		if err != nil {
+			return usageError(err)
+		}
+		write = func(r io.Reader) error {
+			if *parentsFlag {
+				err := os.MkdirAll(filepath.Dir(destPath), 0755)
+				if err != nil {
+					return fmt.Errorf("cannot create parent directories: %w", err)
+				}
+			}
+			return writeLocalFile(destPath, r, nil)
+		}
+	case "ssh":
+		client, err := getSSHClient(repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		sftp, err := client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client: %w", err))
+		}
+		defer sftp.Close()
+
+		destPath = sshPath(repo, name)
+		write = func(r io.Reader) error {
+			if *parentsFlag {
+				err := sftp.MkdirAll(path.Dir(destPath))
+				if err != nil {
+					return fmt.Errorf("cannot create remote parent directories: %w", err)
+				}
+			}
+			return uploadStream(sftp, r, destPath)
+		}
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'put --stdin'", repo.Type))
+	}
+
+	if *dryRunFlag {
+		fmt.Printf("Would upload stdin to '%s'\n", destPath)
+		return nil
+	}
+
+	logf(logVerbose, "Uploading stdin to '%s'\n", destPath)
+	report := startTransfer("upload", "-", destPath)
+	stdin := &countingReader{r: os.Stdin}
+	err := write(stdin)
+	if err != nil {
+		report.fail(err)
+		return transferError(fmt.Errorf("'put' failed: %w", err))
+	}
+
+	report.done(stdin.n, "Uploaded stdin to '%s'\n", destPath)
+	return nil
+}
+
+// uploadStream writes r to remotePath through a temporary file renamed into
+// place once complete.
+func uploadStream(sftp *sftp.Client, r io.Reader, remotePath string) error {
+	tmpPath := tempPath(remotePath)
+	remoteFile, err := sftp.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("could not create remote file: %w", err)
+	}
+	complete := false
+	defer func() {
+		remoteFile.Close()
+		if !complete {
+			sftp.Remove(tmpPath)
+		}
+	}()
+
+	_, err = io.Copy(remoteFile, limitReader(r))
+	if err != nil {
+		return fmt.Errorf("could not copy file contents: %w", err)
+	}
+	err = remoteFile.Close()
+	if err != nil {
+		return fmt.Errorf("could not write remote file: %w", err)
+	}
+
+	err = renameRemote(sftp, tmpPath, remotePath)
+	if err != nil {
+		return err
+	}
+	complete = true
+	return nil
+}
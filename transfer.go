@@ -0,0 +1,240 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// remoteEnd is a side of a transfer between two repositories.
+type remoteEnd struct {
+	repo Repository
+	path string
+	sftp *sftp.Client
+}
+
+// parseRemoteEnd splits repo:path into the repository of config and the
+// path, made absolute in the repository.
+func parseRemoteEnd(config *Config, arg string) (*remoteEnd, error) {
+	name, relPath, found := strings.Cut(arg, ":")
+	if !found || name == "" {
+		return nil, usageError(fmt.Errorf("'%s' is not of the form <repo>:<path>", arg))
+	}
+	repo, ok := config.Repositories[name]
+	if !ok {
+		return nil, configError(fmt.Errorf("repository '%s' not found", name))
+	}
+	if repo.Type != "ssh" {
+		return nil, usageError(fmt.Errorf("repository type '%s' not implemented yet for 'transfer'", repo.Type))
+	}
+	repoPath, err := resolvePath(&repo, relPath)
+	if err != nil {
+		return nil, usageError(err)
+	}
+	return &remoteEnd{repo: repo, path: filepath.ToSlash(repoPath)}, nil
+}
+
+// transferRepositories copies a file or folder from one SSH repository to
+// another, as src and dst of the form <repo>:<path>. Data flows from one
+// SFTP session to the other through this machine, without being written
+// to its disk. As with scp, a file or folder is copied into dst if it is
+// an existing directory.
+func transferRepositories(config *Config, src, dst string) error {
+	source, err := parseRemoteEnd(config, src)
+	if err != nil {
+		return err
+	}
+	dest, err := parseRemoteEnd(config, dst)
+	if err != nil {
+		return err
+	}
+
+	for _, end := range []*remoteEnd{source, dest} {
+		client, err := getSSHClient(&end.repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server of '%s': %w", end.repo.Name, err))
+		}
+		defer client.Close()
+
+		end.sftp, err = client.NewSftp()
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot create SFTP client for '%s': %w", end.repo.Name, err))
+		}
+		defer end.sftp.Close()
+	}
+
+	info, err := source.sftp.Stat(source.path)
+	if err != nil {
+		return transferError(fmt.Errorf("cannot get remote file info: %w", err))
+	}
+	if destInfo, err := dest.sftp.Stat(dest.path); err == nil && destInfo.IsDir() {
+		dest.path = path.Join(dest.path, path.Base(source.path))
+	}
+
+	if info.IsDir() {
+		err = transferDirectory(source, dest)
+	} else {
+		err = transferFile(source.sftp, dest.sftp, source.path, dest.path)
+	}
+	if err != nil {
+		return transferError(fmt.Errorf("'transfer' failed: %w", err))
+	}
+	return nil
+}
+
+// transferDirectory copies the source tree to dest, leaving out the entries
+// filtered by --include, --exclude, --since, --min-size and --max-size.
+// Symbolic links are copied as links.
+func transferDirectory(source, dest *remoteEnd) error {
+	var dirs []string
+	dirInfos := map[string]os.FileInfo{}
+
+	walker := source.sftp.Walk(source.path)
+	for walker.Step() {
+		if walker.Err() != nil {
+			return fmt.Errorf("error walking remote directory: %v", walker.Err())
+		}
+
+		relPath := ""
+		if walker.Path() != source.path {
+			relPath = relativePath(source.path, walker.Path())
+		}
+		srcItemPath := walker.Path()
+		destItemPath := path.Join(dest.path, relPath)
+		info := walker.Stat()
+
+		if relPath != "" && skipEntry(relativePath(source.repo.Path, srcItemPath), info.IsDir()) {
+			if info.IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			err := transferLink(source.sftp, dest.sftp, srcItemPath, destItemPath)
+			if err != nil {
+				return err
+			}
+		case info.IsDir():
+			logf(logVerbose, "Walking '%s'\n", srcItemPath)
+			if *dryRunFlag {
+				fmt.Printf("Would create directory '%s'\n", destItemPath)
+				continue
+			}
+			err := dest.sftp.MkdirAll(destItemPath)
+			if err != nil {
+				return fmt.Errorf("could not create remote directory: %v", err)
+			}
+			dirs = append(dirs, destItemPath)
+			dirInfos[destItemPath] = info
+		case !skipFile(srcItemPath, info):
+			err := transferFile(source.sftp, dest.sftp, srcItemPath, destItemPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Directory modes and times last, once their contents are written
+	for i := len(dirs) - 1; i >= 0; i-- {
+		err := preserveRemote(dest.sftp, dirs[i], dirInfos[dirs[i]])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferLink recreates the symbolic link srcPath at destPath.
+func transferLink(src, dst *sftp.Client, srcPath, destPath string) error {
+	target, err := src.ReadLink(srcPath)
+	if err != nil {
+		return fmt.Errorf("could not read remote link: %v", err)
+	}
+	if *dryRunFlag {
+		fmt.Printf("Would link '%s' to '%s'\n", destPath, target)
+		return nil
+	}
+
+	dst.Remove(destPath)
+	err = dst.Symlink(target, destPath)
+	if err != nil {
+		return fmt.Errorf("could not create remote link: %v", err)
+	}
+	return nil
+}
+
+func transferFile(src, dst *sftp.Client, srcPath, destPath string) error {
+	report := startTransfer("transfer", srcPath, destPath)
+	err := retry(fmt.Sprintf("Transfer of '%s'", srcPath), func() error {
+		return tryTransferFile(src, dst, srcPath, destPath, report)
+	})
+	report.fail(err)
+	return err
+}
+
+// tryTransferFile streams srcPath into a temporary file renamed to destPath
+// once complete.
+func tryTransferFile(src, dst *sftp.Client, srcPath, destPath string, report *transferReport) error {
+	if *dryRunFlag {
+		fmt.Printf("Would transfer '%s' to '%s'\n", srcPath, destPath)
+		return nil
+	}
+
+	logf(logVerbose, "Transferring '%s' to '%s'\n", srcPath, destPath)
+
+	srcFile, err := src.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("could not open source file: %v", err)
+	}
+	defer srcFile.Close()
+
+	srcStat, err := srcFile.Stat()
+	if err != nil {
+		return fmt.Errorf("could not get source file info: %v", err)
+	}
+
+	tmpPath := tempPath(destPath)
+	destFile, err := dst.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("could not create destination file: %w", err)
+	}
+	complete := false
+	defer func() {
+		destFile.Close()
+		if !complete {
+			dst.Remove(tmpPath)
+		}
+	}()
+
+	_, err = io.Copy(destFile, limitReader(srcFile))
+	if err != nil {
+		return fmt.Errorf("could not copy file contents: %w", err)
+	}
+	err = destFile.Close()
+	if err != nil {
+		return fmt.Errorf("could not write destination file: %w", err)
+	}
+
+	err = preserveRemote(dst, tmpPath, srcStat)
+	if err != nil {
+		return err
+	}
+	err = renameRemote(dst, tmpPath, destPath)
+	if err != nil {
+		return err
+	}
+	complete = true
+
+	report.done(srcStat.Size(), "Transferred file '%s' to '%s'\n", srcPath, destPath)
+	return nil
+}
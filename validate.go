@@ -0,0 +1,231 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/melbahja/goph"
+)
+
+// configProblem is a problem found in the configuration, about a repository
+// or about the configuration as a whole when repo is empty.
+type configProblem struct {
+	repo string
+	err  error
+}
+
+func (p *configProblem) Error() string {
+	if p.repo == "" {
+		return p.err.Error()
+	}
+	return fmt.Sprintf("repository '%s': %v", p.repo, p.err)
+}
+
+// validateConfig checks that every repository has the settings its type
+// needs and that the current repository exists. It returns all the problems
+// found, sorted by repository name.
+func validateConfig(config *Config) []error {
+	var problems []error
+
+	if _, ok := config.Repositories[config.Current]; !ok && len(config.Repositories) > 0 {
+		problems = append(problems, &configProblem{err: fmt.Errorf("current repository '%s' does not exist", config.Current)})
+	}
+
+	var names []string
+	for name := range config.Repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		repo := config.Repositories[name]
+		for _, err := range validateRepository(&repo) {
+			problems = append(problems, &configProblem{repo: name, err: err})
+		}
+	}
+
+	return problems
+}
+
+// validateRepository returns the problems of a single repository.
+func validateRepository(repo *Repository) []error {
+	var problems []error
+	missing := func(setting string) {
+		problems = append(problems, fmt.Errorf("missing %s", setting))
+	}
+
+	switch repo.Type {
+	case "local":
+		if repo.Path == "" {
+			missing("path")
+		}
+	case "network":
+		if repo.Path == "" && repo.ShareURL == "" {
+			missing("path or share_url")
+		}
+		if smbShareURL(repo) != "" {
+			_, _, _, err := parseShareURL(smbShareURL(repo))
+			if err != nil {
+				problems = append(problems, err)
+			}
+		}
+	case "ssh":
+		// ~/.ssh/config may provide the host, user and key
+		if repo.SSHHost == "" {
+			if repo.Host == "" {
+				missing("host")
+			}
+			if repo.User == "" {
+				missing("user")
+			}
+		}
+		if repo.Password == "" && repo.PrivateKey == "" && !repo.UseAgent && !repo.KeyboardInteractive && repo.SSHHost == "" && !goph.HasAgent() {
+			missing("password or private_key, and no ssh-agent is running")
+		}
+		if repo.PrivateKey != "" && !goph.HasAgent() {
+			// One readable key is enough, the others are fallbacks
+			homeDir, _ := os.UserHomeDir()
+			var keyErr error
+			for _, keyFile := range privateKeys(repo) {
+				_, keyErr = os.Stat(expandHome(keyFile, homeDir))
+				if keyErr == nil {
+					break
+				}
+			}
+			if keyErr != nil {
+				problems = append(problems, fmt.Errorf("cannot read private key: %w", keyErr))
+			}
+		}
+		if repo.HostKeyFingerprint != "" {
+			hash, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(normalizeFingerprint(repo.HostKeyFingerprint), "SHA256:"))
+			if err != nil || len(hash) != sha256.Size {
+				problems = append(problems, fmt.Errorf("invalid host_key_fingerprint '%s', expected SHA256:<base64>", repo.HostKeyFingerprint))
+			}
+		}
+		if repo.Proxy != "" {
+			if _, err := parseProxyURL(repo.Proxy); err != nil {
+				problems = append(problems, err)
+			}
+		}
+		if repo.Jump != nil {
+			if repo.Proxy != "" {
+				problems = append(problems, errors.New("proxy cannot be used with jump, set it on the jump host"))
+			}
+			jump := *repo.Jump
+			jump.Type = "ssh"
+			for _, err := range validateRepository(&jump) {
+				problems = append(problems, fmt.Errorf("jump host: %w", err))
+			}
+		}
+	case "ftp":
+		if repo.Host == "" {
+			missing("host")
+		}
+	case "s3", "gcs":
+		if repo.Bucket == "" {
+			missing("bucket")
+		}
+	case "azureblob":
+		if repo.AccountName == "" && repo.Endpoint == "" {
+			missing("account_name")
+		}
+		if repo.Container == "" {
+			missing("container")
+		}
+	case "":
+		missing("type")
+	default:
+		problems = append(problems, fmt.Errorf("unknown type '%s'", repo.Type))
+	}
+
+	if repo.Port > 65535 {
+		problems = append(problems, fmt.Errorf("invalid port %d, expected 1 to 65535", repo.Port))
+	}
+
+	if !withinRoot(repositoryRoot(repo), repo.Path) {
+		problems = append(problems, fmt.Errorf("path '%s' is outside of root '%s'", repo.Path, repo.Root))
+	}
+
+	return problems
+}
+
+// isFatal tells whether problem prevents running a command that uses the
+// current repository.
+func isFatal(problem error, config *Config) bool {
+	var p *configProblem
+	return errors.As(problem, &p) && (p.repo == "" || p.repo == config.Current)
+}
+
+// usesRepository tells whether command works on the current repository, as
+// opposed to the commands managing the configuration.
+func usesRepository(command string) bool {
+	switch command {
+	case "list", "repos", "set", "add", "remove", "del-repo", "rename-repo", "copy-repo", "export", "import", "config", "ping", "history", "version", "completion", "__complete":
+		return false
+	}
+	return true
+}
+
+// checkConfig validates the configuration and tries to reach every
+// repository by listing its current directory, without transferring any
+// file. It reports the outcome per repository and fails if any of them is
+// misconfigured or unreachable.
+func checkConfig(config *Config) error {
+	problems := map[string][]error{}
+	for _, problem := range validateConfig(config) {
+		var p *configProblem
+		if errors.As(problem, &p) {
+			problems[p.repo] = append(problems[p.repo], p.err)
+		}
+	}
+
+	// Problems of the configuration as a whole
+	misconfigured, unreachable := len(problems[""]), 0
+	for _, err := range problems[""] {
+		fmt.Printf("FAIL  configuration: %v\n", err)
+	}
+
+	var names []string
+	for name := range config.Repositories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		repo := config.Repositories[name]
+		if errs := problems[name]; len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Printf("FAIL  %s (%s): %v\n", name, repo.Type, err)
+			}
+			misconfigured++
+			continue
+		}
+
+		_, err := listFiles(&repo)
+		if err != nil {
+			fmt.Printf("FAIL  %s (%s): %v\n", name, repo.Type, err)
+			unreachable++
+			continue
+		}
+		fmt.Printf("OK    %s (%s)\n", name, repo.Type)
+	}
+
+	failed := misconfigured + unreachable - len(problems[""])
+	fmt.Printf("%d repositories checked, %d passed, %d failed\n", len(names), len(names)-failed, failed)
+
+	switch {
+	case misconfigured > 0:
+		return configError(fmt.Errorf("configuration '%s' has problems", configFilePath))
+	case unreachable > 0:
+		return connectionError(fmt.Errorf("%d repositories could not be reached", unreachable))
+	}
+	return nil
+}
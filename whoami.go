@@ -0,0 +1,104 @@
+// **********************************************************************
+// Copyright (C) 2025 J.P. Liguori (jpl@ozf.fr)
+// **********************************************************************
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/melbahja/goph"
+)
+
+// whoamiRepository prints the identity the current repository is reached
+// with: the user, host and authentication methods once ~/.ssh/config is
+// applied, confirmed for SSH by running id, or whoami, on the server. Local
+// and network repositories report the local user and their path.
+func whoamiRepository(config *Config) error {
+	// Get current repository
+	repo := currentRepo(config)
+
+	printStatField("Repo", fmt.Sprintf("%s (%s)", config.Current, repo.Type))
+
+	switch repo.Type {
+	case "local", "network":
+		if useSMB(&repo) {
+			account := repo.User
+			if account == "" {
+				account = "guest"
+			} else if repo.Domain != "" && !strings.Contains(account, `\`) {
+				account = repo.Domain + `\` + account
+			}
+			auth := "anonymous"
+			if repo.Password != "" {
+				auth = "password"
+			}
+			printStatField("User", account)
+			printStatField("Share", smbShareURL(&repo))
+			printStatField("Auth", auth)
+			return nil
+		}
+		local, err := user.Current()
+		if err != nil {
+			return fmt.Errorf("cannot get local user: %w", err)
+		}
+		printStatField("User", fmt.Sprintf("%s (uid %s)", local.Username, local.Uid))
+		printStatField("Path", repo.Path)
+	case "ssh":
+		// What getSSHClient connects with
+		resolved, err := resolveSSHRepository(&repo)
+		if err != nil {
+			return configError(err)
+		}
+		printStatField("User", resolved.User)
+		printStatField("Host", net.JoinHostPort(resolved.Host, strconv.Itoa(int(resolved.Port))))
+		printStatField("Auth", describeAuth(&resolved))
+		if resolved.Jump != nil {
+			printStatField("Jump", describeJump(resolved.Jump))
+		} else if resolved.Proxy != "" {
+			printStatField("Proxy", redactProxy(resolved.Proxy))
+		}
+
+		// Confirm the account on the server
+		client, err := getSSHClient(&repo)
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot connect to SSH server: %w", err))
+		}
+		defer client.Close()
+
+		account, err := runRemoteCommand(client, "id")
+		if err != nil {
+			account, err = runRemoteCommand(client, "whoami")
+		}
+		if err != nil {
+			return connectionError(fmt.Errorf("cannot run id nor whoami on the server: %w", err))
+		}
+		printStatField("Remote", account)
+	default:
+		return usageError(fmt.Errorf("repository type '%s' not implemented yet for 'whoami'", repo.Type))
+	}
+
+	return nil
+}
+
+// runRemoteCommand runs command on the SSH server and returns its trimmed
+// output.
+func runRemoteCommand(client *goph.Client, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("could not open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	output, err := session.Output(command)
+	if err != nil {
+		return "", remoteCommandError(err, &stderr)
+	}
+	return strings.TrimSpace(string(output)), nil
+}